@@ -0,0 +1,156 @@
+package wgquick
+
+import (
+	"net"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Standby clones the config for the standby interface of an active/standby pair: same peers, addresses and settings, but its own private key,
+// and its own listen port unless listenPort is 0. PrivateKeyFile, ConfigFile and SaveConfig belong to the active interface and are cleared.
+// Peers need the standby's public key too, e.g. as a second peer entry, before it can take over
+func (cfg *Config) Standby(privateKey wgtypes.Key, listenPort int) *Config {
+	c := cfg.Clone()
+	c.PrivateKey = &privateKey
+	c.PrivateKeyFile = ""
+	if listenPort != 0 {
+		c.ListenPort = &listenPort
+	}
+	c.ConfigFile = ""
+	c.SaveConfig = false
+	return c
+}
+
+// Clone returns a deep copy of the config. Addresses, keys, peers, routes, rules and maps aren't shared, so the copy is safe to mutate independently of cfg
+func (cfg *Config) Clone() *Config {
+	c := *cfg
+
+	c.PrivateKey = cloneKey(cfg.PrivateKey)
+	c.ListenPort = cloneInt(cfg.ListenPort)
+	c.FirewallMark = cloneInt(cfg.FirewallMark)
+	if cfg.Peers != nil {
+		c.Peers = make([]wgtypes.PeerConfig, len(cfg.Peers))
+		for i, peer := range cfg.Peers {
+			c.Peers[i] = clonePeer(peer)
+		}
+	}
+
+	c.Address = cloneIPNets(cfg.Address)
+	if cfg.DNS != nil {
+		c.DNS = make([]net.IP, len(cfg.DNS))
+		for i, ip := range cfg.DNS {
+			c.DNS[i] = cloneIP(ip)
+		}
+	}
+	if cfg.SearchDomains != nil {
+		c.SearchDomains = append([]string(nil), cfg.SearchDomains...)
+	}
+	if cfg.AddressSpecs != nil {
+		c.AddressSpecs = make(map[string]AddressSpec, len(cfg.AddressSpecs))
+		for k, v := range cfg.AddressSpecs {
+			c.AddressSpecs[k] = v
+		}
+	}
+	if cfg.PeerTables != nil {
+		c.PeerTables = make(map[wgtypes.Key]int, len(cfg.PeerTables))
+		for k, v := range cfg.PeerTables {
+			c.PeerTables[k] = v
+		}
+	}
+	if cfg.EndpointHosts != nil {
+		c.EndpointHosts = make(map[wgtypes.Key]string, len(cfg.EndpointHosts))
+		for k, v := range cfg.EndpointHosts {
+			c.EndpointHosts[k] = v
+		}
+	}
+	if cfg.PeerNames != nil {
+		c.PeerNames = make(map[wgtypes.Key]string, len(cfg.PeerNames))
+		for k, v := range cfg.PeerNames {
+			c.PeerNames[k] = v
+		}
+	}
+	if cfg.PeerComments != nil {
+		c.PeerComments = make(map[wgtypes.Key][]string, len(cfg.PeerComments))
+		for k, v := range cfg.PeerComments {
+			c.PeerComments[k] = append([]string(nil), v...)
+		}
+	}
+	c.ExcludedRoutes = cloneIPNets(cfg.ExcludedRoutes)
+	if cfg.Routes != nil {
+		c.Routes = make([]Route, len(cfg.Routes))
+		for i, r := range cfg.Routes {
+			r.Dst = cloneIPNet(r.Dst)
+			r.Gw = cloneIP(r.Gw)
+			c.Routes[i] = r
+		}
+	}
+	if cfg.Rules != nil {
+		c.Rules = make([]Rule, len(cfg.Rules))
+		for i, r := range cfg.Rules {
+			if r.Src != nil {
+				src := cloneIPNet(*r.Src)
+				r.Src = &src
+			}
+			if r.Dst != nil {
+				dst := cloneIPNet(*r.Dst)
+				r.Dst = &dst
+			}
+			c.Rules[i] = r
+		}
+	}
+	// plan is kept, a clone of a config being planned records into the same plan
+	return &c
+}
+
+func clonePeer(peer wgtypes.PeerConfig) wgtypes.PeerConfig {
+	peer.PresharedKey = cloneKey(peer.PresharedKey)
+	if peer.Endpoint != nil {
+		ep := *peer.Endpoint
+		ep.IP = cloneIP(ep.IP)
+		peer.Endpoint = &ep
+	}
+	if peer.PersistentKeepaliveInterval != nil {
+		keepalive := *peer.PersistentKeepaliveInterval
+		peer.PersistentKeepaliveInterval = &keepalive
+	}
+	peer.AllowedIPs = cloneIPNets(peer.AllowedIPs)
+	return peer
+}
+
+func cloneKey(key *wgtypes.Key) *wgtypes.Key {
+	if key == nil {
+		return nil
+	}
+	k := *key
+	return &k
+}
+
+func cloneInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+func cloneIP(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	return append(net.IP{}, ip...)
+}
+
+func cloneIPNet(n net.IPNet) net.IPNet {
+	return net.IPNet{IP: cloneIP(n.IP), Mask: append(net.IPMask(nil), n.Mask...)}
+}
+
+func cloneIPNets(nets []net.IPNet) []net.IPNet {
+	if nets == nil {
+		return nil
+	}
+	c := make([]net.IPNet, len(nets))
+	for i, n := range nets {
+		c[i] = cloneIPNet(n)
+	}
+	return c
+}
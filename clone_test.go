@@ -0,0 +1,58 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClone(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(testConfigs["simple"])))
+	cfg.Routes = []Route{{Dst: cfg.Address[0], Gw: net.ParseIP("10.200.100.1")}}
+	cfg.PeerTables = map[wgtypes.Key]int{}
+
+	c := cfg.Clone()
+	assert.Equal(t, cfg, c)
+
+	c.Address[0].IP[15]++
+	c.DNS[0][15]++
+	c.PrivateKey[0]++
+	c.Peers[0].PresharedKey[0]++
+	c.Peers[0].AllowedIPs[0].Mask[0] = 255
+	c.Peers[0].Endpoint.Port++
+	c.Routes[0].Gw[15]++
+	c.PeerTables[c.Peers[0].PublicKey] = 100
+	assert.Equal(t, "10.200.100.8/24", cfg.Address[0].String())
+	assert.Equal(t, "10.200.100.1", cfg.DNS[0].String())
+	assert.NotEqual(t, *c.PrivateKey, *cfg.PrivateKey)
+	assert.NotEqual(t, *c.Peers[0].PresharedKey, *cfg.Peers[0].PresharedKey)
+	assert.Equal(t, "0.0.0.0/0", cfg.Peers[0].AllowedIPs[0].String())
+	assert.Equal(t, 51820, cfg.Peers[0].Endpoint.Port)
+	assert.Equal(t, "10.200.100.1", cfg.Routes[0].Gw.String())
+	assert.Empty(t, cfg.PeerTables)
+}
+
+func TestStandby(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(testConfigs["sample-2"])))
+	cfg.ConfigFile = "/etc/wireguard/wg0.conf"
+	cfg.SaveConfig = true
+	key, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+
+	c := cfg.Standby(key, 51821)
+	assert.Equal(t, key, *c.PrivateKey)
+	assert.Equal(t, 51821, *c.ListenPort)
+	assert.Equal(t, 51820, *cfg.ListenPort)
+	assert.NotEqual(t, key, *cfg.PrivateKey)
+	assert.Empty(t, c.ConfigFile)
+	assert.False(t, c.SaveConfig)
+	assert.Equal(t, cfg.Peers, c.Peers)
+	assert.Equal(t, cfg.Address, c.Address)
+
+	c = cfg.Standby(key, 0)
+	assert.Equal(t, 51820, *c.ListenPort)
+}
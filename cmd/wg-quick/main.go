@@ -3,10 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 
-	"github.com/sirupsen/logrus"
 	"github.com/uinta-labs/wg-quick-go"
 	"go.uber.org/zap"
 )
@@ -20,25 +18,32 @@ func printHelp() {
 func main() {
 	flag.String("iface", "", "interface")
 	verbose := flag.Bool("v", false, "verbose")
-	protocol := flag.Int("route-protocol", 0, "route protocol to use for our routes")
+	protocol := flag.Int("route-protocol", 0, "route protocol to use for our routes, 0 for the library default")
 	metric := flag.Int("route-metric", 0, "route metric to use for our routes")
+	namespace := flag.String("netns", "", "network namespace to manage the interface in")
+	preserveRoutes := flag.Bool("preserve-routes", false, "keep routes installed earlier which are no longer in the config, instead of deleting them")
 	flag.Parse()
 	args := flag.Args()
 	if len(args) != 2 {
 		printHelp()
 	}
 
-	if *verbose {
-		logrus.SetLevel(logrus.DebugLevel)
+	zapCfg := zap.NewDevelopmentConfig()
+	if !*verbose {
+		zapCfg.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+	}
+	logger, err := zapCfg.Build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot build logger:", err)
+		os.Exit(1)
 	}
 
 	iface := flag.Lookup("iface").Value.String()
-	logger := zap.NewExample()
 	log := logger.With(zap.String("iface", iface))
 
 	cfg := args[1]
 
-	_, err := os.Stat(cfg)
+	_, err = os.Stat(cfg)
 	switch {
 	case err == nil:
 	case os.IsNotExist(err):
@@ -53,34 +58,43 @@ func main() {
 			printHelp()
 		}
 	default:
-		logrus.WithError(err).Errorln("error while reading config file")
+		log.Error("error while reading config file", zap.Error(err))
 		printHelp()
 	}
 
-	b, err := ioutil.ReadFile(cfg)
-	if err != nil {
-		logrus.WithError(err).Fatalln("cannot read file")
+	var c *wgquick.Config
+	if iface == "" {
+		// same as wg-quick, the interface is named after the config file
+		c, iface, err = wgquick.LoadInterface(cfg)
+		log = logger.With(zap.String("iface", iface))
+	} else {
+		c, err = wgquick.LoadConfigFile(cfg)
 	}
-	c := &wgquick.Config{}
-	if err := c.UnmarshalText(b); err != nil {
-		logrus.WithError(err).Fatalln("cannot parse config file")
+	if err != nil {
+		log.Fatal("cannot load config file", zap.Error(err))
 	}
 
 	c.RouteProtocol = *protocol
 	c.RouteMetric = *metric
+	c.Namespace = *namespace
+	c.PreserveRoutes = *preserveRoutes
+	// same as wg-quick, the userspace implementation is only used when the kernel module is missing
+	if userspace := os.Getenv("WG_QUICK_USERSPACE_IMPLEMENTATION"); userspace != "" {
+		c.Userspace = userspace
+	}
 
 	switch args[0] {
 	case "up":
-		if err := wgquick.Up(c, iface, log); err != nil {
-			logrus.WithError(err).Errorln("cannot up interface")
+		if err := wgquick.Up(c, iface, logger); err != nil {
+			log.Error("cannot up interface", zap.Error(err))
 		}
 	case "down":
-		if err := wgquick.Down(c, iface, log); err != nil {
-			logrus.WithError(err).Errorln("cannot down interface")
+		if err := wgquick.Down(c, iface, logger); err != nil {
+			log.Error("cannot down interface", zap.Error(err))
 		}
 	case "sync":
-		if err := wgquick.Sync(c, iface, log); err != nil {
-			logrus.WithError(err).Errorln("cannot sync interface")
+		if err := wgquick.Sync(c, iface, logger); err != nil {
+			log.Error("cannot sync interface", zap.Error(err))
 		}
 	default:
 		printHelp()
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"strconv"
@@ -18,36 +19,180 @@ import (
 type Config struct {
 	wgtypes.Config
 
+	// PrivateKeyFile is a path to a file holding the base64 encoded private key, read on Up and Sync instead of setting PrivateKey, keeping the secret out of the config.
+	// It's not a wg-quick option, when set it's marshaled instead of PrivateKey
+	PrivateKeyFile string
+
 	// Address list of IP (v4 or v6) addresses (optionally with CIDR masks) to be assigned to the interface. May be specified multiple times.
 	Address []net.IPNet
 
 	// list of IP (v4 or v6) addresses to be set as the interface’s DNS servers. May be specified multiple times. Upon bringing the interface up, this runs ‘resolvconf -a tun.INTERFACE -m 0 -x‘ and upon bringing it down, this runs ‘resolvconf -d tun.INTERFACE‘. If these particular invocations of resolvconf(8) are undesirable, the PostUp and PostDown keys below may be used instead.
 	DNS []net.IP
+	// SearchDomains are the non-IP entries of DNS, set as the interface's DNS search domains with the servers
+	SearchDomains []string
+
+	// DNSBackend is how DNS servers are configured on Linux. The default DNSAuto picks one available on the system, so DNS doesn't require resolvconf(8)
+	DNSBackend DNSBackend
 
 	// MTU is automatically determined from the endpoint addresses or the system default route, which is usually a sane choice. However, to manually specify an MTU to override this automatic discovery, this value may be specified explicitly.
 	MTU int
 
-	// Table — Controls the routing table to which routes are added.
+	// MTUOverhead overrides the per-packet overhead subtracted from the path MTU when the MTU is discovered, e.g. IPv6Overhead + 24 to account for GRE over the tunnel.
+	// 0 (the default) uses IPv4Overhead or IPv6Overhead by the endpoint's address family. Linux only
+	MTUOverhead int
+
+	// Table — Controls the routing table to which routes are added. There are two special values: `off` (TableOff) disables the creation of routes altogether, and `auto` (TableAuto, the default) adds routes to the main table.
 	Table int
 
 	// PreUp, PostUp, PreDown, PostDown — script snippets which will be executed by bash(1) before/after setting up/tearing down the interface, most commonly used to configure custom DNS options or firewall rules. The special string ‘%i’ is expanded to INTERFACE. Each one may be specified multiple times, in which case the commands are executed in order.
+	// Multiple commands are kept newline separated, each line is executed on its own and the first failure stops the rest
 	PreUp    string
 	PostUp   string
 	PreDown  string
 	PostDown string
 
-	// RouteProtocol to set on the route. See linux/rtnetlink.h  Use value > 4 or default 0
+	// Runner runs hooks and DNS commands (resolvconf, resolvectl...). Nil means ShellRunner. It's never serialized
+	Runner CommandRunner
+
+	// RouteProtocol to set on the route. See linux/rtnetlink.h  Use value > 4 or default 0, which means DefaultRouteProtocol.
+	// Only routes with this protocol are considered ours, other routes on the link are never deleted
 	RouteProtocol int
 
 	// RouteMetric sets this metric on all managed routes. Lower number means pick this one
 	RouteMetric int
 
+	// RulePriority is the priority of the first of the three policy rules installed for default routes when Table is auto, the others follow it.
+	// 0 (the default) means 32000. Give each interface with default routes its own range, so their rules don't collide
+	RulePriority int
+
+	// PeerTables puts routes for AllowedIPs of the given peers (by public key) into their own routing table instead of Table, e.g. a table per tenant.
+	// Routes in a peer's table are removed on Down, when the peer is removed with RemovePeer, or by Sync once no peer uses the table anymore
+	PeerTables map[wgtypes.Key]int
+
+	// ExcludedRoutes are subtracted from routes for AllowedIPs, e.g. to keep the local LAN reachable when a peer has broad AllowedIPs. The peers' AllowedIPs stay as they are.
+	// Routes containing an excluded prefix are split into the prefixes around it
+	ExcludedRoutes []net.IPNet
+
+	// Routes are installed in addition to routes for peers' AllowedIPs, e.g. routes through a gateway or blackhole routes.
+	// Routes removed from the config are cleaned up by Sync only if they went through the link in the config's table, the rest on Down.
+	Routes []Route
+
+	// Rules are policy routing rules installed by Up and Sync, and removed by Down
+	Rules []Rule
+
+	// PreserveRoutes makes route sync only add missing routes: routes installed by an earlier Up or Sync which are no longer in the config,
+	// e.g. of removed AllowedIPs, are kept until Down. Routes with another protocol (e.g. added by hand) are never deleted, whether it's set or not
+	PreserveRoutes bool
+
+	// RouteConflict decides what happens when a managed route (same destination, table and metric) already exists on another link
+	RouteConflict RouteConflictPolicy
+
+	// EndpointHosts are peer endpoints given as hostname:port, keyed by peer public key. The resolved address is in the peer Endpoint,
+	// hostnames are kept for ResolveEndpoints and serialization. Set by the parsers, or by hand when building the config in code.
+	EndpointHosts map[wgtypes.Key]string
+
+	// PeerComments are comment lines of peers, keyed by peer public key, without the leading `#`. The parser collects comments right above a [Peer] section
+	// and inside it, marshaling writes them all above the section, so annotations like `# laptop` survive a parse-modify-write cycle
+	PeerComments map[wgtypes.Key][]string
+
+	// PeerNames are human readable peer labels keyed by peer public key, e.g. for management UIs. Wireguard has no peer names,
+	// they're kept as a `# Name = laptop` comment above the [Peer] section
+	PeerNames map[wgtypes.Key]string
+
 	// Address label to set on the link
 	AddressLabel string
 
-	// SaveConfig — if set to ‘true’, the configuration is saved from the current state of the interface upon shutdown.
-	// Currently unsupported
+	// AddressSpecs sets scope and label of single addresses, keyed by the address as in Address (e.g. "10.0.0.1/24"). Addresses without a spec get global scope and AddressLabel.
+	// Addresses with a spec are synced even when they're of non-global scope. The wg-quick format has no key for them: MarshalText and SaveConfig drop them,
+	// use the JSON or YAML encoding to keep them
+	AddressSpecs map[string]AddressSpec
+
+	// Userspace is the userspace wireguard implementation (e.g. wireguard-go) run as `Userspace INTERFACE` to create the device when the kernel module isn't available.
+	// The device is then configured over its UAPI socket. Empty (the default) disables the fallback.
+	Userspace string
+
+	// Namespace is the name of the network namespace (as in `ip netns`) the interface lives in. Empty means the current namespace.
+	// Link, addresses, routes, wireguard device and hooks are all handled inside it.
+	Namespace string
+
+	// SaveConfig — if set to ‘true’, the configuration is saved from the current state of the interface upon shutdown to ConfigFile.
 	SaveConfig bool
+
+	// ConfigFile is the path the config was loaded from. It's set by LoadConfigFile and used by SaveConfig, it's never serialized.
+	ConfigFile string
+
+	// plan collects actions instead of applying them during a dry run, see PlanUp
+	plan *[]Action
+}
+
+// Wireguard overhead per packet used by MTU discovery: the outer IP header, the 8 byte UDP header and the 32 byte wireguard header and tag.
+// An MTU of 1500 on the underlay gives 1440 for IPv4 and 1420 for IPv6 endpoints
+const (
+	IPv4Overhead = 20 + 8 + 32
+	IPv6Overhead = 40 + 8 + 32
+)
+
+// DefaultRouteProtocol tags routes managed by this library, when RouteProtocol isn't set
+const DefaultRouteProtocol = 0x57
+
+const (
+	// TableOff disables route creation, routes are expected to be managed externally
+	TableOff = -1
+	// TableAuto adds routes to the default table
+	TableAuto = 0
+)
+
+// RouteConflictPolicy is what to do with routes already existing on another link
+type RouteConflictPolicy int
+
+const (
+	// RouteConflictReplace takes the route over from the other link
+	RouteConflictReplace RouteConflictPolicy = iota
+	// RouteConflictSkip logs and leaves the other link's route alone
+	RouteConflictSkip
+	// RouteConflictError fails the route sync
+	RouteConflictError
+)
+
+// AddressSpec is how a single address is added to the link
+type AddressSpec struct {
+	// Scope of the address, e.g. unix.RT_SCOPE_LINK. 0 is global scope
+	Scope int
+	// Label overrides AddressLabel for the address
+	Label string
+}
+
+// DNSBackend is the mechanism used to configure DNS servers on the system. Down tears down DNS with the same backend Up used
+type DNSBackend int
+
+const (
+	// DNSAuto uses resolvconf if it's in PATH, otherwise resolvectl, otherwise DNSFile
+	DNSAuto DNSBackend = iota
+	// DNSResolvconf registers the servers with resolvconf(8) as tun.INTERFACE, like wg-quick
+	DNSResolvconf
+	// DNSResolvectl sets the servers on the link with resolvectl(1) of systemd-resolved
+	DNSResolvectl
+	// DNSFile overwrites /etc/resolv.conf, the original is backed up next to it and restored on Down
+	DNSFile
+	// DNSResolved sets the servers on the link through systemd-resolved's D-Bus API (SetLinkDNS), so they're only used for the interface and not globally.
+	// Down reverts the link with RevertLink
+	DNSResolved
+)
+
+func (b DNSBackend) String() string {
+	switch b {
+	case DNSAuto:
+		return "auto"
+	case DNSResolvconf:
+		return "resolvconf"
+	case DNSResolvectl:
+		return "resolvectl"
+	case DNSFile:
+		return "file"
+	case DNSResolved:
+		return "resolved"
+	}
+	return fmt.Sprintf("DNSBackend(%d)", int(b))
 }
 
 var _ encoding.TextMarshaler = (*Config)(nil)
@@ -65,13 +210,42 @@ func serializeKey(key *wgtypes.Key) string {
 	return base64.StdEncoding.EncodeToString(key[:])
 }
 
+func serializeKeyHex(key *wgtypes.Key) string {
+	return hex.EncodeToString(key[:])
+}
+
 func toSeconds(duration time.Duration) int {
 	return int(duration / time.Second)
 }
 
+func toHex(i *int) string {
+	return fmt.Sprintf("0x%x", *i)
+}
+
+// nonZero reports whether i is set to something other than 0, e.g. FwMark = off is a pointer to 0 and isn't rendered
+func nonZero(i *int) bool {
+	return i != nil && *i != 0
+}
+
+// tableString renders a Table value the way wg-quick expects it, with the special values as `off` and `auto`
+func tableString(table int) string {
+	switch table {
+	case TableOff:
+		return "off"
+	case TableAuto:
+		return "auto"
+	}
+	return strconv.Itoa(table)
+}
+
 var funcMap = template.FuncMap(map[string]interface{}{
+	"table":     tableString,
+	"lines":     hookLines,
 	"wgKey":     serializeKey,
 	"toSeconds": toSeconds,
+	"hex":       toHex,
+	"nonZero":   nonZero,
+	"endpoint":  (*Config).endpointString,
 })
 
 var cfgTemplate = template.Must(
@@ -95,37 +269,82 @@ Address = {{ . }}
 {{- range .DNS }}
 DNS = {{ . }}
 {{- end }}
+{{- range .SearchDomains }}
+DNS = {{ . }}
+{{- end }}
+{{- if .PrivateKeyFile }}
+PrivateKeyFile = {{ .PrivateKeyFile }}
+{{- else }}
 PrivateKey = {{ .PrivateKey | wgKey }}
+{{- end }}
 {{- if .ListenPort }}{{ "\n" }}ListenPort = {{ .ListenPort }}{{ end }}
+{{- if nonZero .FirewallMark }}{{ "\n" }}FwMark = {{ .FirewallMark | hex }}{{ end }}
 {{- if .MTU }}{{ "\n" }}MTU = {{ .MTU }}{{ end }}
-{{- if .Table }}{{ "\n" }}Table = {{ .Table }}{{ end }}
-{{- if .PreUp }}{{ "\n" }}PreUp = {{ .PreUp }}{{ end }}
-{{- if .PostUp }}{{ "\n" }}PostUp = {{ .PostUp }}{{ end }}
-{{- if .PreDown }}{{ "\n" }}PreDown = {{ .PreDown }}{{ end }}
-{{- if .PostDown }}{{ "\n" }}PostDown = {{ .PostDown }}{{ end }}
+{{- if .Table }}{{ "\n" }}Table = {{ table .Table }}{{ end }}
+{{- range lines .PreUp }}{{ "\n" }}PreUp = {{ . }}{{ end }}
+{{- range lines .PostUp }}{{ "\n" }}PostUp = {{ . }}{{ end }}
+{{- range lines .PreDown }}{{ "\n" }}PreDown = {{ . }}{{ end }}
+{{- range lines .PostDown }}{{ "\n" }}PostDown = {{ . }}{{ end }}
 {{- if .SaveConfig }}{{ "\n" }}SaveConfig = {{ .SaveConfig }}{{ end }}
-{{- range .Peers }}
+{{- range $peer := .Peers }}
 {{- "\n" }}
+{{- with index $.PeerNames .PublicKey }}
+# Name = {{ . }}
+{{- end }}
+{{- range index $.PeerComments .PublicKey }}
+# {{ . }}
+{{- end }}
 [Peer]
 PublicKey = {{ .PublicKey | wgKey }}
 AllowedIPs = {{ range $i, $el := .AllowedIPs }}{{if $i}}, {{ end }}{{ $el }}{{ end }}
-{{- if .PresharedKey }}{{ "\n" }}PresharedKey = {{ .PresharedKey }}{{ end }}
+{{- if .PresharedKey }}{{ "\n" }}PresharedKey = {{ .PresharedKey | wgKey }}{{ end }}
 {{- if .PersistentKeepaliveInterval }}{{ "\n" }}PersistentKeepalive = {{ .PersistentKeepaliveInterval | toSeconds }}{{ end }}
-{{- if .Endpoint }}{{ "\n" }}Endpoint = {{ .Endpoint }}{{ end }}
+{{- if .Endpoint }}{{ "\n" }}Endpoint = {{ endpoint $ $peer }}{{ end }}
 {{- end }}
 `
 
 // ParseKey parses the base64 encoded wireguard private key
 func ParseKey(key string) (wgtypes.Key, error) {
-	var pkey wgtypes.Key
 	pkeySlice, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
-		return pkey, err
+		return wgtypes.Key{}, err
+	}
+	return keyFromBytes(pkeySlice)
+}
+
+// ParseKeyHex parses a hex encoded wireguard key, as used by the UAPI and `wg show` dumps of userspace implementations
+func ParseKeyHex(key string) (wgtypes.Key, error) {
+	pkeySlice, err := hex.DecodeString(key)
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+	return keyFromBytes(pkeySlice)
+}
+
+func keyFromBytes(b []byte) (wgtypes.Key, error) {
+	var pkey wgtypes.Key
+	if len(b) != wgtypes.KeyLen {
+		return pkey, fmt.Errorf("invalid key length %d, expected %d bytes", len(b), wgtypes.KeyLen)
 	}
-	copy(pkey[:], pkeySlice[:])
+	copy(pkey[:], b)
 	return pkey, nil
 }
 
+// GeneratePrivateKey generates a new wireguard private key
+func GeneratePrivateKey() (wgtypes.Key, error) {
+	return wgtypes.GeneratePrivateKey()
+}
+
+// GeneratePresharedKey generates a new random wireguard preshared key
+func GeneratePresharedKey() (wgtypes.Key, error) {
+	return wgtypes.GenerateKey()
+}
+
+// PublicKey derives the public key from the wireguard private key
+func PublicKey(priv wgtypes.Key) wgtypes.Key {
+	return priv.PublicKey()
+}
+
 type parseState int
 
 const (
@@ -138,24 +357,46 @@ func (cfg *Config) UnmarshalText(text []byte) error {
 	*cfg = Config{} // Zero out the config
 	state := unknown
 	var peerCfg *wgtypes.PeerConfig
+	// endpoints are resolved once the whole config is read, public key and addresses may follow the Endpoint line
+	type peerEndpoint struct {
+		line     int
+		peer     int
+		endpoint string
+	}
+	var endpoints []peerEndpoint
+	// comments go to the peer section they're in, or the one following them. Peers are keyed by public key, which is only known at the end
+	var pending []string
+	var peerComments [][]string
 	for no, line := range strings.Split(string(text), "\n") {
 		ln := strings.TrimSpace(line)
-		if len(ln) == 0 || ln[0] == '#' {
+		if len(ln) == 0 {
+			continue
+		}
+		if ln[0] == '#' {
+			pending = append(pending, strings.TrimSpace(ln[1:]))
 			continue
 		}
-		switch ln {
-		case "[Interface]":
+		switch strings.ToLower(ln) {
+		case "[interface]":
 			state = inter
-		case "[Peer]":
+			pending = nil
+		case "[peer]":
 			state = peer
 			cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{})
 			peerCfg = &cfg.Peers[len(cfg.Peers)-1]
+			peerComments = append(peerComments, pending)
+			pending = nil
 		default:
+			if state == peer {
+				peerComments[len(peerComments)-1] = append(peerComments[len(peerComments)-1], pending...)
+			}
+			pending = nil
+
 			parts := strings.Split(ln, "=")
 			if len(parts) < 2 {
-				return fmt.Errorf("cannot parse line %d, missing =", no)
+				return fmt.Errorf("[line %d]: cannot parse, missing =", no+1)
 			}
-			lhs := strings.TrimSpace(parts[0])
+			lhs := canonicalKey(strings.TrimSpace(parts[0]))
 			rhs := strings.TrimSpace(strings.Join(parts[1:], "="))
 
 			switch state {
@@ -164,6 +405,10 @@ func (cfg *Config) UnmarshalText(text []byte) error {
 					return fmt.Errorf("[line %d]: %v", no+1, err)
 				}
 			case peer:
+				if lhs == "Endpoint" {
+					endpoints = append(endpoints, peerEndpoint{line: no + 1, peer: len(cfg.Peers) - 1, endpoint: rhs})
+					break
+				}
 				if err := parsePeerLine(peerCfg, lhs, rhs); err != nil {
 					return fmt.Errorf("[line %d]: %v", no+1, err)
 				}
@@ -172,25 +417,135 @@ func (cfg *Config) UnmarshalText(text []byte) error {
 			}
 		}
 	}
+	if state == peer {
+		// trailing comments of the last peer
+		peerComments[len(peerComments)-1] = append(peerComments[len(peerComments)-1], pending...)
+	}
+	for i, comments := range peerComments {
+		var name string
+		if name, comments = peerName(comments); name != "" {
+			if cfg.PeerNames == nil {
+				cfg.PeerNames = make(map[wgtypes.Key]string)
+			}
+			cfg.PeerNames[cfg.Peers[i].PublicKey] = name
+		}
+		if len(comments) == 0 {
+			continue
+		}
+		if cfg.PeerComments == nil {
+			cfg.PeerComments = make(map[wgtypes.Key][]string)
+		}
+		cfg.PeerComments[cfg.Peers[i].PublicKey] = comments
+	}
+	for _, ep := range endpoints {
+		if err := cfg.setEndpoint(&cfg.Peers[ep.peer], ep.endpoint); err != nil {
+			return fmt.Errorf("[line %d]: %w", ep.line, err)
+		}
+	}
 	return nil
 }
+
+// peerName takes the first `Name = value` comment out of the peer's comments
+func peerName(comments []string) (string, []string) {
+	for i, comment := range comments {
+		parts := strings.SplitN(comment, "=", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "Name") {
+			rest := append(comments[:i:i], comments[i+1:]...)
+			return strings.TrimSpace(parts[1]), rest
+		}
+	}
+	return "", comments
+}
+
+// appendLine appends a repeated hook to the previous ones
+func appendLine(lines string, line string) string {
+	if lines == "" {
+		return line
+	}
+	return lines + "\n" + line
+}
+
+// hookLines splits a hook into its commands, empty lines are skipped
+func hookLines(hook string) []string {
+	var lines []string
+	for _, line := range strings.Split(hook, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// configKeys are the keys as spelled in the wg-quick docs, by lower case
+var configKeys = func() map[string]string {
+	keys := make(map[string]string)
+	for _, key := range []string{
+		"Address", "DNS", "MTU", "Table", "ListenPort", "FwMark", "PreUp", "PostUp", "PreDown", "PostDown", "SaveConfig", "PrivateKey", "PrivateKeyFile",
+		"PublicKey", "PresharedKey", "AllowedIPs", "Endpoint", "PersistentKeepalive",
+	} {
+		keys[strings.ToLower(key)] = key
+	}
+	return keys
+}()
+
+// canonicalKey spells the key as in the wg-quick docs, keys are case insensitive like in wg-quick. Unknown keys are returned as is
+func canonicalKey(key string) string {
+	if k, ok := configKeys[strings.ToLower(key)]; ok {
+		return k
+	}
+	return key
+}
+
+// parseIPNet parses an address in CIDR notation, keeping the host part. A bare IP gets the host mask, /32 or /128 as wg-quick does
+func parseIPNet(s string) (net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return net.IPNet{}, fmt.Errorf("invalid IP address")
+		}
+		if ip.To4() != nil {
+			return net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	ip, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		return net.IPNet{}, err
+	}
+	return net.IPNet{IP: ip, Mask: cidr.Mask}, nil
+}
+
+// parseAllowedIP parses an AllowedIPs entry in canonical form, host bits masked off as the kernel keeps it, so 10.0.0.5/24 is 10.0.0.0/24
+func parseAllowedIP(s string) (net.IPNet, error) {
+	ipNet, err := parseIPNet(s)
+	if err != nil {
+		return net.IPNet{}, err
+	}
+	return net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask}, nil
+}
+
 func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 	switch lhs {
 	case "Address":
 		for _, addr := range strings.Split(rhs, ",") {
-			ip, cidr, err := net.ParseCIDR(strings.TrimSpace(addr))
+			ipNet, err := parseIPNet(strings.TrimSpace(addr))
 			if err != nil {
 				return err
 			}
-			cfg.Address = append(cfg.Address, net.IPNet{IP: ip, Mask: cidr.Mask})
+			cfg.Address = append(cfg.Address, ipNet)
 		}
 	case "DNS":
-		for _, addr := range strings.Split(rhs, ",") {
-			ip := net.ParseIP(strings.TrimSpace(addr))
-			if ip == nil {
-				return fmt.Errorf("cannot parse IP")
+		for _, entry := range strings.Split(rhs, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			// like wg-quick, anything which isn't an IP is a search domain
+			if ip := net.ParseIP(entry); ip != nil {
+				cfg.DNS = append(cfg.DNS, ip)
+			} else {
+				cfg.SearchDomains = append(cfg.SearchDomains, entry)
 			}
-			cfg.DNS = append(cfg.DNS, ip)
 		}
 	case "MTU":
 		mtu, err := strconv.ParseInt(rhs, 10, 64)
@@ -199,11 +554,18 @@ func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 		}
 		cfg.MTU = int(mtu)
 	case "Table":
-		tbl, err := strconv.ParseInt(rhs, 10, 64)
-		if err != nil {
-			return err
+		switch rhs {
+		case "off":
+			cfg.Table = TableOff
+		case "auto":
+			cfg.Table = TableAuto
+		default:
+			tbl, err := strconv.ParseInt(rhs, 10, 64)
+			if err != nil {
+				return err
+			}
+			cfg.Table = int(tbl)
 		}
-		cfg.Table = int(tbl)
 	case "ListenPort":
 		portI64, err := strconv.ParseInt(rhs, 10, 64)
 		if err != nil {
@@ -211,14 +573,25 @@ func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 		}
 		port := int(portI64)
 		cfg.ListenPort = &port
+	case "FwMark":
+		mark := 0
+		if rhs != "off" {
+			// marks are u32, as in wg(8)
+			markU64, err := strconv.ParseUint(rhs, 0, 32)
+			if err != nil {
+				return err
+			}
+			mark = int(markU64)
+		}
+		cfg.FirewallMark = &mark
 	case "PreUp":
-		cfg.PreUp = rhs
+		cfg.PreUp = appendLine(cfg.PreUp, rhs)
 	case "PostUp":
-		cfg.PostUp = rhs
+		cfg.PostUp = appendLine(cfg.PostUp, rhs)
 	case "PreDown":
-		cfg.PreDown = rhs
+		cfg.PreDown = appendLine(cfg.PreDown, rhs)
 	case "PostDown":
-		cfg.PostDown = rhs
+		cfg.PostDown = appendLine(cfg.PostDown, rhs)
 	case "SaveConfig":
 		save, err := strconv.ParseBool(rhs)
 		if err != nil {
@@ -231,6 +604,8 @@ func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 			return fmt.Errorf("cannot decode key %v", err)
 		}
 		cfg.PrivateKey = &key
+	case "PrivateKeyFile":
+		cfg.PrivateKeyFile = rhs
 	default:
 		return fmt.Errorf("unknown directive %s", lhs)
 	}
@@ -251,24 +626,26 @@ func parsePeerLine(peerCfg *wgtypes.PeerConfig, lhs string, rhs string) error {
 			return fmt.Errorf("cannot decode key %v", err)
 		}
 		if peerCfg.PresharedKey != nil {
-			return fmt.Errorf("preshared key already defined %v", err)
+			return fmt.Errorf("preshared key already defined")
 		}
 		peerCfg.PresharedKey = &key
 	case "AllowedIPs":
 		for _, addr := range strings.Split(rhs, ",") {
-			ip, cidr, err := net.ParseCIDR(strings.TrimSpace(addr))
+			addr = strings.TrimSpace(addr)
+			if addr == "" {
+				continue
+			}
+			ipNet, err := parseAllowedIP(addr)
 			if err != nil {
-				return fmt.Errorf("cannot parse %s: %v", addr, err)
+				return fmt.Errorf("cannot parse AllowedIPs %q: %v", addr, err)
 			}
-			peerCfg.AllowedIPs = append(peerCfg.AllowedIPs, net.IPNet{IP: ip, Mask: cidr.Mask})
+			peerCfg.AllowedIPs = append(peerCfg.AllowedIPs, ipNet)
 		}
-	case "Endpoint":
-		addr, err := net.ResolveUDPAddr("", rhs)
-		if err != nil {
-			return err
-		}
-		peerCfg.Endpoint = addr
 	case "PersistentKeepalive":
+		if rhs == "off" {
+			peerCfg.PersistentKeepaliveInterval = nil
+			break
+		}
 		t, err := strconv.ParseInt(rhs, 10, 64)
 		if err != nil {
 			return err
@@ -1,11 +1,20 @@
 package wgquick
 
 import (
+	"flag"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
+var update = flag.Bool("update", false, "update golden files in testdata")
+
 var testConfigs = map[string]string{
 	"simple": `[Interface]
 Address = 10.200.100.8/24
@@ -17,6 +26,16 @@ PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
 AllowedIPs = 0.0.0.0/0
 PresharedKey = /UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=
 Endpoint = 123.12.12.1:51820
+`,
+	"search-domains": `[Interface]
+Address = 10.200.100.8/24
+DNS = 10.200.100.1
+DNS = corp.example.com
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = 0.0.0.0/0
 `,
 	"sample-2": `[Interface]
 Address = 10.192.122.1/24
@@ -27,7 +46,7 @@ SaveConfig = true
 
 [Peer]
 PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
-AllowedIPs = 10.192.122.3/32, 10.192.124.1/24
+AllowedIPs = 10.192.122.3/32, 10.192.124.0/24
 
 [Peer]
 PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
@@ -49,6 +68,38 @@ PreDown = ip rule delete ipproto tcp dport 22 table 1234
 PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
 AllowedIPs = 0.0.0.0/0
 PersistentKeepalive = 25
+`,
+	"fwmark": `[Interface]
+Address = 10.192.122.1/24
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+FwMark = 0xca6c
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32
+`,
+	"dual-stack": `[Interface]
+Address = 10.192.122.1/24
+Address = fd00::1/64
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32, fd00::3/128
+`,
+	"hooks": `[Interface]
+Address = 10.192.122.1/24
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Table = 1234
+PreUp = echo pre-up %i
+PostUp = ip rule add ipproto tcp dport 22 table 1234
+PreDown = ip rule delete ipproto tcp dport 22 table 1234
+PostDown = echo post-down %i
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0
 `,
 }
 
@@ -65,3 +116,432 @@ func TestExampleConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestUnmarshalCommentsAndRepeatedKeys(t *testing.T) {
+	c := &Config{}
+	err := c.UnmarshalText([]byte(`# wg0 config
+[Interface]
+Address = 10.192.122.1/24, 10.10.0.1/16
+Address = fd00::1/64
+DNS = 1.1.1.1, 8.8.8.8
+  # indented comment
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+MTU = 1420
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32
+AllowedIPs = 10.192.124.1/24
+PersistentKeepalive = 25
+`))
+	assert.NoError(t, err)
+	assert.Len(t, c.Address, 3)
+	assert.Len(t, c.DNS, 2)
+	assert.Equal(t, 1420, c.MTU)
+	if assert.Len(t, c.Peers, 1) {
+		assert.Len(t, c.Peers[0].AllowedIPs, 2)
+		assert.Equal(t, 25*time.Second, *c.Peers[0].PersistentKeepaliveInterval)
+	}
+}
+
+func TestPeerComments(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`# interface comments aren't kept
+[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+# laptop
+#added 2020-01-02
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+# office LAN
+AllowedIPs = 10.192.122.3/32
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.122.4/32
+# phone
+`)))
+	assert.Equal(t, map[wgtypes.Key][]string{
+		c.Peers[0].PublicKey: {"laptop", "added 2020-01-02", "office LAN"},
+		c.Peers[1].PublicKey: {"phone"},
+	}, c.PeerComments)
+
+	b, err := c.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+# laptop
+# added 2020-01-02
+# office LAN
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32
+
+# phone
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.122.4/32
+`, string(b))
+
+	rt := &Config{}
+	assert.NoError(t, rt.UnmarshalText(b))
+	assert.Equal(t, c.PeerComments, rt.PeerComments)
+}
+
+func TestPeerNames(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+# added 2020-01-02
+# name = Alice's laptop
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32
+`)))
+	key := c.Peers[0].PublicKey
+	assert.Equal(t, map[wgtypes.Key]string{key: "Alice's laptop"}, c.PeerNames)
+	assert.Equal(t, []string{"added 2020-01-02"}, c.PeerComments[key])
+
+	c.PeerNames[key] = "phone"
+	b, err := c.MarshalText()
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "\n\n# Name = phone\n# added 2020-01-02\n[Peer]\n")
+
+	rt := &Config{}
+	assert.NoError(t, rt.UnmarshalText(b))
+	assert.Equal(t, "phone", rt.PeerNames[key])
+}
+
+func TestSearchDomains(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+DNS = 10.0.0.1, corp.example.com, fd00::1
+DNS = example.com
+`)))
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")}, c.DNS)
+	assert.Equal(t, []string{"corp.example.com", "example.com"}, c.SearchDomains)
+
+	b, err := c.MarshalText()
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "DNS = 10.0.0.1\nDNS = fd00::1\nDNS = corp.example.com\nDNS = example.com\n")
+
+	rt := &Config{}
+	assert.NoError(t, rt.UnmarshalText(b))
+	assert.Equal(t, c.DNS, rt.DNS)
+	assert.Equal(t, c.SearchDomains, rt.SearchDomains)
+}
+
+func TestFwMark(t *testing.T) {
+	iface := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n"
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(iface+"FwMark = 0xffffffff\n")))
+	assert.Equal(t, 0xffffffff, *c.FirewallMark)
+	b, err := c.MarshalText()
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "\nFwMark = 0xffffffff\n")
+
+	c = &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(iface+"FwMark = 2147483648\n")))
+	assert.Equal(t, 0x80000000, *c.FirewallMark)
+
+	c = &Config{}
+	assert.Error(t, c.UnmarshalText([]byte(iface+"FwMark = 0x100000000\n")))
+
+	c = &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(iface+"FwMark = off\n")))
+	assert.Equal(t, 0, *c.FirewallMark)
+	b, err = c.MarshalText()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "FwMark")
+}
+
+func TestUnmarshalMissingEquals(t *testing.T) {
+	c := &Config{}
+	err := c.UnmarshalText([]byte("[Interface]\nAddress\n"))
+	assert.EqualError(t, err, "[line 2]: cannot parse, missing =")
+}
+
+func TestUnmarshalCaseInsensitive(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`[interface]
+address=10.200.100.8/24
+  DNS   =   10.200.100.1
+PRIVATEKEY = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+postup = echo up
+saveconfig = false
+
+[PEER]
+publickey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+allowedips = 0.0.0.0/0
+presharedkey=/UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=
+ENDPOINT = 123.12.12.1:51820
+`)))
+	expected := &Config{}
+	assert.NoError(t, expected.UnmarshalText([]byte(testConfigs["simple"])))
+	expected.PostUp = "echo up"
+	assert.Equal(t, expected, c)
+
+	assert.EqualError(t, c.UnmarshalText([]byte("[Interface]\nFoo = bar\n")), "[line 2]: unknown directive Foo")
+}
+
+func TestRepeatedHooks(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+PostUp = iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
+PostDown = iptables -D FORWARD -i %i -j ACCEPT
+`)))
+	assert.Equal(t, "iptables -A FORWARD -i %i -j ACCEPT\niptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE", c.PostUp)
+	assert.Equal(t, []string{"iptables -A FORWARD -i %i -j ACCEPT", "iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE"}, hookLines(c.PostUp))
+	assert.Contains(t, c.String(), `
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+PostUp = iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
+PostDown = iptables -D FORWARD -i %i -j ACCEPT
+`)
+}
+
+// goldenConfigs are built in code rather than parsed, so the golden files test the template alone
+func goldenConfigs(t *testing.T) map[string]*Config {
+	mustKey := func(s string) *wgtypes.Key {
+		key, err := ParseKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &key
+	}
+	mustCIDR := func(s string) net.IPNet {
+		ip, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.IP = ip
+		return *n
+	}
+	listenPort := 51820
+	keepalive := 25 * time.Second
+
+	minimal := &Config{}
+	minimal.PrivateKey = mustKey("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+
+	iface := &Config{
+		Address:  []net.IPNet{mustCIDR("10.192.122.1/24"), mustCIDR("fd00::1/64")},
+		DNS:      []net.IP{net.ParseIP("1.1.1.1"), net.ParseIP("2606:4700:4700::1111")},
+		MTU:      1380,
+		Table:    TableOff,
+		PreUp:    "echo pre-up %i",
+		PostUp:   "echo post-up %i",
+		PreDown:  "echo pre-down %i",
+		PostDown: "echo post-down %i",
+	}
+	iface.PrivateKey = mustKey("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+	iface.ListenPort = &listenPort
+
+	peer := &Config{Address: []net.IPNet{mustCIDR("fd00::1/64")}}
+	peer.PrivateKey = mustKey("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+	peer.Peers = []wgtypes.PeerConfig{{
+		PublicKey:                   *mustKey("xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="),
+		PresharedKey:                mustKey("/UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak="),
+		Endpoint:                    &net.UDPAddr{IP: net.ParseIP("fd00:1::1"), Port: 51820},
+		PersistentKeepaliveInterval: &keepalive,
+		AllowedIPs:                  []net.IPNet{mustCIDR("10.192.122.3/32"), mustCIDR("fd00::3/128")},
+	}}
+
+	return map[string]*Config{
+		"minimal":   minimal,
+		"interface": iface,
+		"peer":      peer,
+	}
+}
+
+// TestMarshalGolden compares MarshalText with testdata/marshal/*.conf. Run with -update to rewrite the files after intended template changes
+func TestMarshalGolden(t *testing.T) {
+	for name, cfg := range goldenConfigs(t) {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("testdata", "marshal", name+".conf")
+			b, err := cfg.MarshalText()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if *update {
+				assert.NoError(t, ioutil.WriteFile(path, b, 0644))
+			}
+			golden, err := ioutil.ReadFile(path)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, string(golden), string(b))
+
+			// and it parses back to the same text
+			rt := &Config{}
+			assert.NoError(t, rt.UnmarshalText(golden))
+			b, err = rt.MarshalText()
+			assert.NoError(t, err)
+			assert.Equal(t, string(golden), string(b))
+		})
+	}
+}
+
+func TestUnmarshalTableSpecialValues(t *testing.T) {
+	for value, want := range map[string]int{
+		"off":  TableOff,
+		"auto": TableAuto,
+		"1234": 1234,
+	} {
+		c := &Config{}
+		err := c.UnmarshalText([]byte("[Interface]\nTable = " + value + "\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, want, c.Table, value)
+	}
+}
+
+func TestMarshalTableSpecialValues(t *testing.T) {
+	priv, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	c := &Config{Table: TableOff}
+	c.PrivateKey = &priv
+	b, err := c.MarshalText()
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "\nTable = off\n")
+
+	rt := &Config{}
+	assert.NoError(t, rt.UnmarshalText(b))
+	assert.Equal(t, TableOff, rt.Table)
+
+	// auto is wg-quick's default, it's left out
+	c.Table = TableAuto
+	b, err = c.MarshalText()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "Table")
+}
+
+func TestPublicKey(t *testing.T) {
+	priv, err := ParseKey("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+	assert.NoError(t, err)
+	assert.Equal(t, "HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw=", PublicKey(priv).String())
+}
+
+func TestGeneratePrivateKey(t *testing.T) {
+	k1, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	k2, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, k1, k2)
+	assert.NotEqual(t, PublicKey(k1), PublicKey(k2))
+}
+
+func TestUnmarshalPresharedKey(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	psk, err := ParseKey("/UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=")
+	assert.NoError(t, err)
+	if assert.NotNil(t, c.Peers[0].PresharedKey) {
+		assert.Equal(t, psk, *c.Peers[0].PresharedKey)
+	}
+
+	peer := "[Interface]\nPrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=\n\n[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\n"
+	err = c.UnmarshalText([]byte(peer + "PresharedKey = AAAA\n"))
+	assert.EqualError(t, err, "[line 6]: cannot decode key invalid key length 3, expected 32 bytes")
+	err = c.UnmarshalText([]byte(peer + "PresharedKey = " + psk.String() + "\nPresharedKey = " + psk.String() + "\n"))
+	assert.EqualError(t, err, "[line 7]: preshared key already defined")
+}
+
+func TestUnmarshalAllowedIPs(t *testing.T) {
+	peer := "[Interface]\nPrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=\n\n[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\n"
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(peer+"AllowedIPs = 10.0.0.0/24,  10.0.1.5/24 ,192.168.0.0/16, 10.1.0.2, fd00::2, fd00:1::1/64,\n")))
+	var ips []string
+	for _, ip := range c.Peers[0].AllowedIPs {
+		ips = append(ips, ip.String())
+	}
+	assert.Equal(t, []string{"10.0.0.0/24", "10.0.1.0/24", "192.168.0.0/16", "10.1.0.2/32", "fd00::2/128", "fd00:1::/64"}, ips)
+
+	err := c.UnmarshalText([]byte(peer + "AllowedIPs = 10.0.0.0/24, 10.0.1.0/33\n"))
+	assert.EqualError(t, err, `[line 6]: cannot parse AllowedIPs "10.0.1.0/33": invalid CIDR address: 10.0.1.0/33`)
+	err = c.UnmarshalText([]byte(peer + "AllowedIPs = 10.0.0.0/24, example.com\n"))
+	assert.EqualError(t, err, `[line 6]: cannot parse AllowedIPs "example.com": invalid IP address`)
+}
+
+func TestUnmarshalBareAddress(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte("[Interface]\nAddress = 10.0.0.2, fd00::2\nPrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=\n")))
+	assert.Equal(t, "10.0.0.2/32", c.Address[0].String())
+	assert.Equal(t, "fd00::2/128", c.Address[1].String())
+
+	b, err := c.MarshalText()
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "Address = 10.0.0.2/32\nAddress = fd00::2/128\n")
+	rt := &Config{}
+	assert.NoError(t, rt.UnmarshalText(b))
+	assert.Equal(t, c.Address, rt.Address)
+}
+
+func TestMarshalGeneratedPresharedKey(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(testConfigs["sample-3"])))
+	psk, err := GeneratePresharedKey()
+	assert.NoError(t, err)
+	c.Peers[0].PresharedKey = &psk
+	assert.Contains(t, c.String(), "\nPresharedKey = "+psk.String()+"\n")
+}
+
+func TestPersistentKeepaliveRoundTrip(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(testConfigs["sample-3"])))
+	keepalive := 42 * time.Second
+	c.Peers[0].PersistentKeepaliveInterval = &keepalive
+
+	c2 := &Config{}
+	assert.NoError(t, c2.UnmarshalText([]byte(c.String())))
+	if assert.NotNil(t, c2.Peers[0].PersistentKeepaliveInterval) {
+		assert.Equal(t, keepalive, *c2.Peers[0].PersistentKeepaliveInterval)
+	}
+
+	c.Peers[0].PersistentKeepaliveInterval = nil
+	assert.NotContains(t, c.String(), "PersistentKeepalive")
+
+	assert.NoError(t, c2.UnmarshalText([]byte(strings.Replace(testConfigs["sample-3"], "PersistentKeepalive = 25", "PersistentKeepalive = off", 1))))
+	assert.Nil(t, c2.Peers[0].PersistentKeepaliveInterval)
+}
+
+func TestMarshalMultipleAddressAndDNS(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`[Interface]
+Address = 10.0.0.1/24, fd00::1/64
+DNS = 1.1.1.1, 2606:4700:4700::1111
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+`)))
+	assert.Equal(t, `[Interface]
+Address = 10.0.0.1/24
+Address = fd00::1/64
+DNS = 1.1.1.1
+DNS = 2606:4700:4700::1111
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+`, c.String())
+}
+
+func TestParseKeyLength(t *testing.T) {
+	_, err := ParseKey("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+	assert.NoError(t, err)
+	_, err = ParseKey("yAnz5TF+lXXJte14tji3zlMNq+hd2rYU")
+	assert.EqualError(t, err, "invalid key length 24, expected 32 bytes")
+	_, err = ParseKey("")
+	assert.Error(t, err)
+}
+
+func TestParseKeyHex(t *testing.T) {
+	key, err := ParseKeyHex("c809f3e5317e9575c9b5ed78b638b7ce530dabe85ddab614220241801ddf0669")
+	assert.NoError(t, err)
+	assert.Equal(t, "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=", serializeKey(&key))
+	assert.Equal(t, "c809f3e5317e9575c9b5ed78b638b7ce530dabe85ddab614220241801ddf0669", serializeKeyHex(&key))
+
+	_, err = ParseKeyHex("c809f3e5317e9575c9b5ed78b638b7ce")
+	assert.EqualError(t, err, "invalid key length 16, expected 32 bytes")
+	_, err = ParseKeyHex("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+	assert.Error(t, err)
+}
@@ -0,0 +1,231 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// InterfaceDiff is the difference between the desired config and the live interface. Add* are in the config, but missing on the interface, Del* are the other way around
+type InterfaceDiff struct {
+	AddAddresses []net.IPNet
+	DelAddresses []net.IPNet
+
+	AddRoutes []net.IPNet
+	DelRoutes []net.IPNet
+
+	AddPeers []wgtypes.Key
+	DelPeers []wgtypes.Key
+	// UpdatePeers are present on both sides, but with different AllowedIPs, endpoint, preshared key or keepalive. See DiffPeers for the details
+	UpdatePeers []wgtypes.Key
+
+	PrivateKey   bool
+	ListenPort   bool
+	FirewallMark bool
+}
+
+// Empty reports whether the interface already matches the config
+func (d *InterfaceDiff) Empty() bool {
+	return len(d.AddAddresses) == 0 && len(d.DelAddresses) == 0 &&
+		len(d.AddRoutes) == 0 && len(d.DelRoutes) == 0 &&
+		len(d.AddPeers) == 0 && len(d.DelPeers) == 0 && len(d.UpdatePeers) == 0 &&
+		!d.PrivateKey && !d.ListenPort && !d.FirewallMark
+}
+
+// Diff compares the config with the live interface without changing anything.
+// Routes (AllowedIPs and Routes through the link) are compared in the config's table only, default routes handled by Table = auto are left out.
+// Only routes tagged with our RouteProtocol are considered.
+func Diff(cfg *Config, iface string) (*InterfaceDiff, error) {
+	var diff *InterfaceDiff
+	err := inNamespace(cfg, func() (err error) {
+		diff, err = diffInNamespace(cfg, iface)
+		return err
+	})
+	return diff, err
+}
+
+func diffInNamespace(cfg *Config, iface string) (*InterfaceDiff, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if link.Type() != "wireguard" && !isUserspaceLink(link) {
+		return nil, fmt.Errorf("%w: %s has type %s", ErrNotWireguard, iface, link.Type())
+	}
+	cl, err := wgctrl.New()
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+	dev, err := cl.Device(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	nlAddrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []net.IPNet
+	for _, addr := range nlAddrs {
+		if !syncedAddr(cfg, addr) {
+			continue
+		}
+		addrs = append(addrs, *addr.IPNet)
+	}
+
+	var routes []net.IPNet
+	if cfg.Table != TableOff {
+		table := cfg.Table
+		if table == TableAuto {
+			table = unix.RT_TABLE_MAIN
+		}
+		nlRoutes, err := netlink.RouteListFiltered(
+			netlink.FAMILY_ALL,
+			&netlink.Route{LinkIndex: link.Attrs().Index, Table: table},
+			netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, rt := range nlRoutes {
+			if rt.Dst != nil && rt.Protocol == routeProtocol(cfg) {
+				routes = append(routes, *rt.Dst)
+			}
+		}
+	}
+
+	return diffDevice(cfg, dev, addrs, routes), nil
+}
+
+func diffDevice(cfg *Config, dev *wgtypes.Device, addrs []net.IPNet, routes []net.IPNet) *InterfaceDiff {
+	diff := &InterfaceDiff{
+		AddAddresses: diffIPNets(cfg.Address, addrs),
+		DelAddresses: diffIPNets(addrs, cfg.Address),
+	}
+
+	if cfg.Table != TableOff {
+		wanted := peerRoutes(cfg)
+		if cfg.Table == TableAuto {
+			_, wanted = splitDefaultRoutes(wanted)
+		}
+		for _, r := range cfg.Routes {
+			if !r.Blackhole && (r.Table == 0 || r.Table == cfg.Table) {
+				wanted = append(wanted, r.Dst)
+			}
+		}
+		wanted = maskedIPNets(wanted)
+		diff.AddRoutes = diffIPNets(wanted, routes)
+		diff.DelRoutes = diffIPNets(routes, wanted)
+	}
+
+	if cfg.PrivateKey != nil && *cfg.PrivateKey != dev.PrivateKey {
+		diff.PrivateKey = true
+	}
+	if cfg.ListenPort != nil && *cfg.ListenPort != dev.ListenPort {
+		diff.ListenPort = true
+	}
+	if cfg.FirewallMark != nil && *cfg.FirewallMark != dev.FirewallMark {
+		diff.FirewallMark = true
+	}
+
+	present := make(map[wgtypes.Key]bool, len(dev.Peers))
+	for _, p := range dev.Peers {
+		present[p.PublicKey] = true
+	}
+	changed := diffPeers(cfg, dev)
+	wantedPeers := make(map[wgtypes.Key]bool, len(cfg.Peers))
+	for _, peer := range cfg.Peers {
+		wantedPeers[peer.PublicKey] = true
+		switch {
+		case !present[peer.PublicKey]:
+			diff.AddPeers = append(diff.AddPeers, peer.PublicKey)
+		case changed[peer.PublicKey] != nil:
+			diff.UpdatePeers = append(diff.UpdatePeers, peer.PublicKey)
+		}
+	}
+	for _, p := range dev.Peers {
+		if !wantedPeers[p.PublicKey] {
+			diff.DelPeers = append(diff.DelPeers, p.PublicKey)
+		}
+	}
+	return diff
+}
+
+// PeerDiff is how a peer on the device differs from the config
+type PeerDiff struct {
+	PublicKey wgtypes.Key
+	// AddAllowedIPs are in the config, but not on the device, DelAllowedIPs the other way around
+	AddAllowedIPs []net.IPNet
+	DelAllowedIPs []net.IPNet
+	// Endpoint differs. It's only compared if set in the config, since it roams
+	Endpoint bool
+	// PresharedKey differs, including set on one side only
+	PresharedKey bool
+	// PersistentKeepalive differs, unset counts as off
+	PersistentKeepalive bool
+}
+
+// Empty reports whether the peer on the device matches the config
+func (d *PeerDiff) Empty() bool {
+	return len(d.AddAllowedIPs) == 0 && len(d.DelAllowedIPs) == 0 && !d.Endpoint && !d.PresharedKey && !d.PersistentKeepalive
+}
+
+// DiffPeers reads the live wireguard device and compares its peers with the config, by public key. Only peers on both sides which differ are returned,
+// peers missing on either side are AddPeers and DelPeers of Diff. Nothing is changed
+func DiffPeers(cfg *Config, iface string) (map[wgtypes.Key]*PeerDiff, error) {
+	var diffs map[wgtypes.Key]*PeerDiff
+	err := inNamespace(cfg, func() error {
+		dev, err := DeviceStatus(iface)
+		if err != nil {
+			return err
+		}
+		diffs = diffPeers(cfg, dev)
+		return nil
+	})
+	return diffs, err
+}
+
+func diffPeers(cfg *Config, dev *wgtypes.Device) map[wgtypes.Key]*PeerDiff {
+	present := make(map[wgtypes.Key]wgtypes.Peer, len(dev.Peers))
+	for _, p := range dev.Peers {
+		present[p.PublicKey] = p
+	}
+	diffs := make(map[wgtypes.Key]*PeerDiff)
+	for _, peer := range cfg.Peers {
+		p, ok := present[peer.PublicKey]
+		if !ok {
+			continue
+		}
+		if d := diffPeer(peer, p); !d.Empty() {
+			diffs[peer.PublicKey] = d
+		}
+	}
+	return diffs
+}
+
+func diffPeer(peer wgtypes.PeerConfig, p wgtypes.Peer) *PeerDiff {
+	d := &PeerDiff{PublicKey: peer.PublicKey}
+	wantPSK := wgtypes.Key{}
+	if peer.PresharedKey != nil {
+		wantPSK = *peer.PresharedKey
+	}
+	d.PresharedKey = wantPSK != p.PresharedKey
+	var wantKeepalive int
+	if peer.PersistentKeepaliveInterval != nil {
+		wantKeepalive = toSeconds(*peer.PersistentKeepaliveInterval)
+	}
+	d.PersistentKeepalive = wantKeepalive != toSeconds(p.PersistentKeepaliveInterval)
+	d.Endpoint = peer.Endpoint != nil && (p.Endpoint == nil || peer.Endpoint.String() != p.Endpoint.String())
+	wanted := maskedIPNets(peer.AllowedIPs)
+	d.AddAllowedIPs = diffIPNets(wanted, p.AllowedIPs)
+	d.DelAllowedIPs = diffIPNets(p.AllowedIPs, wanted)
+	return d
+}
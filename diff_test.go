@@ -0,0 +1,87 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestDiffDevice(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(testConfigs["sample-2"])))
+	parse := func(cidr string) net.IPNet {
+		ip, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return net.IPNet{IP: ip, Mask: n.Mask}
+	}
+
+	var peers []wgtypes.Peer
+	for _, peer := range cfg.Peers {
+		peers = append(peers, wgtypes.Peer{PublicKey: peer.PublicKey, AllowedIPs: maskedIPNets(peer.AllowedIPs)})
+	}
+	dev := &wgtypes.Device{
+		PrivateKey: *cfg.PrivateKey,
+		ListenPort: *cfg.ListenPort,
+		Peers:      peers,
+	}
+	routes := maskedIPNets(peerRoutes(cfg))
+
+	diff := diffDevice(cfg, dev, cfg.Address, routes)
+	assert.True(t, diff.Empty(), "%+v", diff)
+
+	stale, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	keepalive := 25 * time.Second
+	dev.Peers = append(dev.Peers[:2], wgtypes.Peer{PublicKey: stale})
+	dev.Peers[1].PersistentKeepaliveInterval = keepalive
+	dev.ListenPort = 1234
+	diff = diffDevice(cfg, dev, []net.IPNet{cfg.Address[0], parse("10.20.0.1/24")}, append(routes[1:], parse("10.20.0.0/24")))
+	assert.False(t, diff.Empty())
+	assert.Equal(t, []net.IPNet{cfg.Address[1]}, diff.AddAddresses)
+	assert.Equal(t, []net.IPNet{parse("10.20.0.1/24")}, diff.DelAddresses)
+	assert.Equal(t, routes[:1], diff.AddRoutes)
+	assert.Equal(t, []net.IPNet{parse("10.20.0.0/24")}, diff.DelRoutes)
+	assert.Equal(t, []wgtypes.Key{cfg.Peers[2].PublicKey}, diff.AddPeers)
+	assert.Equal(t, []wgtypes.Key{stale}, diff.DelPeers)
+	assert.Equal(t, []wgtypes.Key{cfg.Peers[1].PublicKey}, diff.UpdatePeers)
+	assert.True(t, diff.ListenPort)
+	assert.False(t, diff.PrivateKey)
+	assert.False(t, diff.FirewallMark)
+}
+
+func TestDiffPeers(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(testConfigs["simple"])))
+	peer := cfg.Peers[0]
+	_, extra, _ := net.ParseCIDR("10.30.0.0/16")
+
+	dev := &wgtypes.Device{Peers: []wgtypes.Peer{{
+		PublicKey:    peer.PublicKey,
+		PresharedKey: *peer.PresharedKey,
+		Endpoint:     peer.Endpoint,
+		AllowedIPs:   maskedIPNets(peer.AllowedIPs),
+	}}}
+	assert.Empty(t, diffPeers(cfg, dev))
+
+	dev.Peers[0].PresharedKey = wgtypes.Key{}
+	dev.Peers[0].Endpoint = &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820}
+	dev.Peers[0].PersistentKeepaliveInterval = 25 * time.Second
+	dev.Peers[0].AllowedIPs = []net.IPNet{*extra}
+	diffs := diffPeers(cfg, dev)
+	assert.Equal(t, map[wgtypes.Key]*PeerDiff{peer.PublicKey: {
+		PublicKey:           peer.PublicKey,
+		AddAllowedIPs:       maskedIPNets(peer.AllowedIPs),
+		DelAllowedIPs:       []net.IPNet{*extra},
+		Endpoint:            true,
+		PresharedKey:        true,
+		PersistentKeepalive: true,
+	}}, diffs)
+}
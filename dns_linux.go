@@ -0,0 +1,224 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// resolvConfPath is the file DNSFile overwrites
+var resolvConfPath = "/etc/resolv.conf"
+
+// resolvConfBackup is where DNSFile keeps the original resolv.conf while the interface is up
+func resolvConfBackup(iface string) string {
+	return resolvConfPath + ".wg-quick." + iface
+}
+
+// detectDNSBackend picks the backend for DNSAuto, the first one available on the system
+func detectDNSBackend() DNSBackend {
+	if _, err := exec.LookPath("resolvconf"); err == nil {
+		return DNSResolvconf
+	}
+	if _, err := exec.LookPath("resolvectl"); err == nil {
+		return DNSResolvectl
+	}
+	return DNSFile
+}
+
+// dnsBackend is the backend DNS is set or unset with. For DNSAuto a resolv.conf backup of the interface means DNSFile was used,
+// so Down restores it even if resolvconf was installed meanwhile
+func dnsBackend(cfg *Config, iface string) DNSBackend {
+	if cfg.DNSBackend != DNSAuto {
+		return cfg.DNSBackend
+	}
+	if _, err := os.Lstat(resolvConfBackup(iface)); err == nil {
+		return DNSFile
+	}
+	return detectDNSBackend()
+}
+
+// hasDNS reports whether the config has any DNS to set, servers or search domains
+func hasDNS(cfg *Config) bool {
+	return len(cfg.DNS) > 0 || len(cfg.SearchDomains) > 0
+}
+
+func setDNS(ctx context.Context, cfg *Config, iface string, log *zap.Logger) error {
+	backend := dnsBackend(cfg, iface)
+	log = log.With(zap.Stringer("backend", backend))
+	var err error
+	switch backend {
+	case DNSResolvconf:
+		if _, err := exec.LookPath("resolvconf"); err != nil {
+			log.Error("cannot set DNS", zap.Error(err))
+			return ErrResolvconfNotFound
+		}
+		var stdin []string
+		for _, dns := range cfg.DNS {
+			stdin = append(stdin, fmt.Sprintf("nameserver %s\n", dns))
+		}
+		if len(cfg.SearchDomains) > 0 {
+			stdin = append(stdin, fmt.Sprintf("search %s\n", strings.Join(cfg.SearchDomains, " ")))
+		}
+		err = execSh(ctx, cfg, "resolvconf -a tun.%i -m 0 -x", iface, log, stdin...)
+	case DNSResolvectl:
+		servers := make([]string, 0, len(cfg.DNS))
+		for _, dns := range cfg.DNS {
+			servers = append(servers, dns.String())
+		}
+		if len(servers) > 0 {
+			err = execSh(ctx, cfg, "resolvectl dns %i "+strings.Join(servers, " "), iface, log)
+		}
+		if err == nil && len(cfg.SearchDomains) > 0 {
+			err = execSh(ctx, cfg, "resolvectl domain %i "+strings.Join(cfg.SearchDomains, " "), iface, log)
+		}
+	case DNSFile:
+		err = writeResolvConf(cfg, iface, log)
+	case DNSResolved:
+		var index int
+		index, err = resolvedLinkIndex(cfg, iface)
+		if err == nil && len(cfg.DNS) > 0 {
+			err = execSh(ctx, cfg, resolvedCall("SetLinkDNS", "ia(iay)", setLinkDNSArgs(index, cfg.DNS)...), iface, log)
+		}
+		if err == nil && len(cfg.SearchDomains) > 0 {
+			err = execSh(ctx, cfg, resolvedCall("SetLinkDomains", "ia(sb)", setLinkDomainsArgs(index, cfg.SearchDomains)...), iface, log)
+		}
+	default:
+		err = fmt.Errorf("unknown DNS backend %s", backend)
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("set DNS")
+	return nil
+}
+
+func unsetDNS(ctx context.Context, cfg *Config, iface string, log *zap.Logger) error {
+	backend := dnsBackend(cfg, iface)
+	log = log.With(zap.Stringer("backend", backend))
+	var err error
+	switch backend {
+	case DNSResolvconf:
+		if _, err := exec.LookPath("resolvconf"); err != nil {
+			log.Error("cannot unset DNS", zap.Error(err))
+			return ErrResolvconfNotFound
+		}
+		err = execSh(ctx, cfg, "resolvconf -d tun.%i", iface, log)
+	case DNSResolvectl:
+		err = execSh(ctx, cfg, "resolvectl revert %i", iface, log)
+	case DNSFile:
+		err = restoreResolvConf(cfg, iface, log)
+	case DNSResolved:
+		var index int
+		index, err = resolvedLinkIndex(cfg, iface)
+		if err == nil {
+			err = execSh(ctx, cfg, resolvedCall("RevertLink", "i", strconv.Itoa(index)), iface, log)
+		}
+	default:
+		err = fmt.Errorf("unknown DNS backend %s", backend)
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("unset DNS")
+	return nil
+}
+
+// writeResolvConf moves resolv.conf aside and writes one with the config's servers. Moving keeps a symlinked resolv.conf (e.g. to resolved's stub) intact for the restore.
+// An existing backup is never overwritten, it may be the only copy of the original
+func writeResolvConf(cfg *Config, iface string, log *zap.Logger) error {
+	backup := resolvConfBackup(iface)
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# written by wg-quick for %s, the original is in %s\n", iface, backup)
+	for _, dns := range cfg.DNS {
+		fmt.Fprintf(b, "nameserver %s\n", dns)
+	}
+	if len(cfg.SearchDomains) > 0 {
+		fmt.Fprintf(b, "search %s\n", strings.Join(cfg.SearchDomains, " "))
+	}
+	return cfg.apply(log, "file write", resolvConfPath, func() error {
+		if _, err := os.Lstat(backup); err == nil {
+			log.Error("resolv.conf backup already exists", zap.String("path", backup))
+			return os.ErrExist
+		}
+		if err := os.Rename(resolvConfPath, backup); err != nil {
+			log.Error("cannot back up resolv.conf", zap.Error(err))
+			return err
+		}
+		if err := ioutil.WriteFile(resolvConfPath, []byte(b.String()), 0644); err != nil {
+			log.Error("cannot write resolv.conf", zap.Error(err))
+			if err := os.Rename(backup, resolvConfPath); err != nil {
+				log.Error("cannot restore resolv.conf", zap.Error(err))
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// restoreResolvConf puts the original resolv.conf back. Without a backup there's nothing to restore, e.g. DNS was never set
+func restoreResolvConf(cfg *Config, iface string, log *zap.Logger) error {
+	backup := resolvConfBackup(iface)
+	if _, err := os.Lstat(backup); os.IsNotExist(err) && !cfg.dryRun() {
+		log.Info("no resolv.conf backup, nothing to restore")
+		return nil
+	}
+	return cfg.apply(log, "file restore", resolvConfPath, func() error {
+		if err := os.Rename(backup, resolvConfPath); err != nil {
+			log.Error("cannot restore resolv.conf", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+// resolvedCall is the busctl(1) command calling method of systemd-resolved's Manager, with signature and arguments in busctl's notation
+func resolvedCall(method string, signature string, args ...string) string {
+	return "busctl call org.freedesktop.resolve1 /org/freedesktop/resolve1 org.freedesktop.resolve1.Manager " +
+		method + " '" + signature + "' " + strings.Join(args, " ")
+}
+
+// setLinkDNSArgs are the SetLinkDNS arguments: the link index and an array of (address family, address bytes)
+func setLinkDNSArgs(index int, servers []net.IP) []string {
+	args := []string{strconv.Itoa(index), strconv.Itoa(len(servers))}
+	for _, ip := range servers {
+		family, b := unix.AF_INET6, ip.To16()
+		if ip4 := ip.To4(); ip4 != nil {
+			family, b = unix.AF_INET, ip4
+		}
+		args = append(args, strconv.Itoa(family), strconv.Itoa(len(b)))
+		for _, x := range b {
+			args = append(args, strconv.Itoa(int(x)))
+		}
+	}
+	return args
+}
+
+// setLinkDomainsArgs are the SetLinkDomains arguments: the link index and an array of (domain, routing only). Search domains aren't routing only
+func setLinkDomainsArgs(index int, domains []string) []string {
+	args := []string{strconv.Itoa(index), strconv.Itoa(len(domains))}
+	for _, domain := range domains {
+		args = append(args, domain, "false")
+	}
+	return args
+}
+
+// resolvedLinkIndex is the index resolved knows the link by. A dry run may not have created the link, 0 stands in for it then
+func resolvedLinkIndex(cfg *Config, iface string) (int, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		if cfg.dryRun() {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return link.Attrs().Index, nil
+}
@@ -0,0 +1,63 @@
+package wgquick
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDNSFileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-dns")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func(path string) { resolvConfPath = path }(resolvConfPath)
+	resolvConfPath = filepath.Join(dir, "resolv.conf")
+	assert.NoError(t, ioutil.WriteFile(resolvConfPath, []byte("nameserver 192.168.1.1\n"), 0644))
+
+	cfg := &Config{DNS: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")}, SearchDomains: []string{"corp.example.com", "example.com"}, DNSBackend: DNSFile}
+	assert.NoError(t, setDNS(context.Background(), cfg, "wg0", zap.NewNop()))
+	b, err := ioutil.ReadFile(resolvConfPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "nameserver 10.0.0.1\nnameserver fd00::1\nsearch corp.example.com example.com\n")
+
+	// a second set would lose the original
+	assert.Error(t, setDNS(context.Background(), cfg, "wg0", zap.NewNop()))
+
+	// auto finds the backup, whatever else is installed
+	assert.Equal(t, DNSFile, dnsBackend(&Config{}, "wg0"))
+
+	assert.NoError(t, unsetDNS(context.Background(), cfg, "wg0", zap.NewNop()))
+	b, err = ioutil.ReadFile(resolvConfPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "nameserver 192.168.1.1\n", string(b))
+
+	// nothing left to restore
+	assert.NoError(t, unsetDNS(context.Background(), cfg, "wg0", zap.NewNop()))
+}
+
+func TestDNSBackendExplicit(t *testing.T) {
+	assert.Equal(t, DNSResolvectl, dnsBackend(&Config{DNSBackend: DNSResolvectl}, "wg0"))
+	assert.Equal(t, "resolvectl", DNSResolvectl.String())
+}
+
+func TestSetLinkDNSArgs(t *testing.T) {
+	args := setLinkDNSArgs(5, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")})
+	assert.Equal(t, []string{
+		"5", "2",
+		"2", "4", "10", "0", "0", "1",
+		"10", "16", "253", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "1",
+	}, args)
+	assert.Equal(t,
+		"busctl call org.freedesktop.resolve1 /org/freedesktop/resolve1 org.freedesktop.resolve1.Manager RevertLink 'i' 5",
+		resolvedCall("RevertLink", "i", "5"),
+	)
+	assert.Equal(t, []string{"5", "2", "corp.example.com", "false", "example.com", "false"}, setLinkDomainsArgs(5, []string{"corp.example.com", "example.com"}))
+}
@@ -0,0 +1,65 @@
+package wgquick
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Action is a single change to the system Up, Down or Sync would make
+type Action struct {
+	// Op is the kind of change, e.g. "link add", "addr del", "route replace", "exec"
+	Op string
+	// Args is the subject of the change, e.g. the address, route or command
+	Args string
+}
+
+func (a Action) String() string {
+	return a.Op + " " + a.Args
+}
+
+// PlanUp returns the actions Up would take without applying them
+func PlanUp(cfg *Config, iface string, logger *zap.Logger) ([]Action, error) {
+	return plan(cfg, func(c *Config) error {
+		return UpContext(context.Background(), c, iface, logger)
+	})
+}
+
+// PlanDown returns the actions Down would take without applying them
+func PlanDown(cfg *Config, iface string, logger *zap.Logger) ([]Action, error) {
+	return plan(cfg, func(c *Config) error {
+		return DownContext(context.Background(), c, iface, logger)
+	})
+}
+
+// PlanSync returns the actions Sync would take without applying them
+func PlanSync(cfg *Config, iface string, logger *zap.Logger) ([]Action, error) {
+	return plan(cfg, func(c *Config) error {
+		return Sync(c, iface, logger)
+	})
+}
+
+// plan runs fn on a deep copy of cfg, so steps which update the config, e.g. resolving endpoints, don't leak into the caller's
+func plan(cfg *Config, fn func(c *Config) error) ([]Action, error) {
+	actions := []Action{}
+	c := cfg.Clone()
+	c.plan = &actions
+	if err := fn(c); err != nil {
+		return actions, err
+	}
+	return actions, nil
+}
+
+func (cfg *Config) dryRun() bool {
+	return cfg.plan != nil
+}
+
+// apply runs fn, unless it's a dry run. Then the action is only recorded into the plan
+func (cfg *Config) apply(log *zap.Logger, op string, args string, fn func() error) error {
+	if cfg.dryRun() {
+		*cfg.plan = append(*cfg.plan, Action{Op: op, Args: args})
+		log.Info("dry run, not applying", zap.String("op", op), zap.String("args", args))
+		return nil
+	}
+	return fn()
+}
@@ -0,0 +1,31 @@
+package wgquick
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestApplyDryRun(t *testing.T) {
+	actions := []Action{}
+	cfg := &Config{plan: &actions}
+	called := false
+	err := cfg.apply(zap.NewNop(), "addr add", "10.0.0.1/24", func() error {
+		called = true
+		return errors.New("should not be called")
+	})
+	assert.NoError(t, err)
+	assert.False(t, called)
+	assert.Equal(t, []Action{{Op: "addr add", Args: "10.0.0.1/24"}}, actions)
+	assert.Equal(t, "addr add 10.0.0.1/24", actions[0].String())
+
+	cfg = &Config{}
+	err = cfg.apply(zap.NewNop(), "addr add", "10.0.0.1/24", func() error {
+		called = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, called)
+}
@@ -0,0 +1,210 @@
+package wgquick
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ErrEndpointResolve is returned when a peer endpoint hostname cannot be resolved
+var ErrEndpointResolve = errors.New("cannot resolve endpoint")
+
+// lookupIP is replaced in tests
+var lookupIP = net.LookupIP
+
+// ResolveEndpoints resolves peer endpoints given as hostnames (see EndpointHosts) again and updates peer Endpoints in place.
+// Endpoints are resolved when parsing and on Up, call it to follow servers with changing addresses (e.g. dynamic DNS).
+func (cfg *Config) ResolveEndpoints() error {
+	for i := range cfg.Peers {
+		peer := &cfg.Peers[i]
+		host, ok := cfg.EndpointHosts[peer.PublicKey]
+		if !ok {
+			continue
+		}
+		addr, err := resolveEndpoint(host, cfg.preferIPv6())
+		if err != nil {
+			return err
+		}
+		peer.Endpoint = addr
+	}
+	return nil
+}
+
+// setEndpoint sets the peer endpoint, resolving it if it's a hostname. Hostnames are remembered in EndpointHosts, so the peer must have its public key set.
+func (cfg *Config) setEndpoint(peer *wgtypes.PeerConfig, endpoint string) error {
+	addr, err := resolveEndpoint(endpoint, cfg.preferIPv6())
+	if err != nil {
+		return err
+	}
+	peer.Endpoint = addr
+	host, _, _ := net.SplitHostPort(endpoint)
+	if net.ParseIP(host) != nil {
+		delete(cfg.EndpointHosts, peer.PublicKey)
+		return nil
+	}
+	if cfg.EndpointHosts == nil {
+		cfg.EndpointHosts = make(map[wgtypes.Key]string)
+	}
+	cfg.EndpointHosts[peer.PublicKey] = endpoint
+	return nil
+}
+
+// endpointString is the peer endpoint as configured, the hostname if there's one
+func (cfg *Config) endpointString(peer wgtypes.PeerConfig) string {
+	if host, ok := cfg.EndpointHosts[peer.PublicKey]; ok {
+		return host
+	}
+	if peer.Endpoint == nil {
+		return ""
+	}
+	return peer.Endpoint.String()
+}
+
+// preferIPv6 reports whether endpoints should be resolved to IPv6 addresses first. That's the case only when the interface has IPv6 addresses only.
+func (cfg *Config) preferIPv6() bool {
+	if len(cfg.Address) == 0 {
+		return false
+	}
+	for _, addr := range cfg.Address {
+		if addr.IP.To4() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveEndpoint parses host:port, looking up the host if it's not an IP address. If the host has both A and AAAA records, the family is chosen by preferIPv6.
+func resolveEndpoint(endpoint string, preferIPv6 bool) (*net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrEndpointResolve, endpoint, err)
+	}
+	port, err := net.LookupPort("udp", portStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrEndpointResolve, endpoint, err)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+	ips, err := lookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrEndpointResolve, endpoint, err)
+	}
+	var v4, v6 net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			if v4 == nil {
+				v4 = ip.To4()
+			}
+		} else if v6 == nil {
+			v6 = ip
+		}
+	}
+	ip := v4
+	if ip == nil || (preferIPv6 && v6 != nil) {
+		ip = v6
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("%w %s: no addresses found", ErrEndpointResolve, endpoint)
+	}
+	return &net.UDPAddr{IP: ip, Port: port}, nil
+}
+
+// ReresolveDNS periodically resolves peer endpoint hostnames (see EndpointHosts) and updates the endpoint on the running interface when the address changed,
+// keeping tunnels to servers behind dynamic DNS alive. Peers with endpoints given as addresses are never touched.
+// Failures are logged and retried on the next tick. cfg isn't modified and may be used concurrently. Call the returned func to stop it.
+func ReresolveDNS(cfg *Config, iface string, interval time.Duration, logger *zap.Logger) (stop func()) {
+	log := ifaceLogger(logger, iface)
+	hosts := make(map[wgtypes.Key]string)
+	endpoints := make(map[wgtypes.Key]string)
+	for _, peer := range cfg.Peers {
+		host, ok := cfg.EndpointHosts[peer.PublicKey]
+		if !ok {
+			continue
+		}
+		hosts[peer.PublicKey] = host
+		if peer.Endpoint != nil {
+			endpoints[peer.PublicKey] = peer.Endpoint.String()
+		}
+	}
+	nsCfg := &Config{Namespace: cfg.Namespace}
+	preferIPv6 := cfg.preferIPv6()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			peers := changedEndpoints(hosts, endpoints, preferIPv6, log)
+			if len(peers) == 0 {
+				continue
+			}
+			if err := inNamespace(nsCfg, func() error {
+				defer lockIface(nsCfg, iface)()
+				cl, err := wgctrl.New()
+				if err != nil {
+					return err
+				}
+				defer cl.Close()
+				return cl.ConfigureDevice(iface, wgtypes.Config{Peers: peers})
+			}); err != nil {
+				log.Error("cannot update peer endpoints", zap.Error(err))
+				continue
+			}
+			for _, peer := range peers {
+				endpoints[peer.PublicKey] = peer.Endpoint.String()
+				log.Info("updated peer endpoint",
+					zap.String("peer", peer.PublicKey.String()),
+					zap.String("endpoint", peer.Endpoint.String()),
+				)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// changedEndpoints resolves hosts and returns peer updates for those resolving to a different address than in endpoints
+func changedEndpoints(hosts map[wgtypes.Key]string, endpoints map[wgtypes.Key]string, preferIPv6 bool, log *zap.Logger) []wgtypes.PeerConfig {
+	keys := make([]wgtypes.Key, 0, len(hosts))
+	for key := range hosts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	var peers []wgtypes.PeerConfig
+	for _, key := range keys {
+		addr, err := resolveEndpoint(hosts[key], preferIPv6)
+		if err != nil {
+			log.Warn("cannot re-resolve peer endpoint", zap.String("peer", key.String()), zap.Error(err))
+			continue
+		}
+		if addr.String() == endpoints[key] {
+			continue
+		}
+		peers = append(peers, wgtypes.PeerConfig{
+			PublicKey:  key,
+			UpdateOnly: true,
+			Endpoint:   addr,
+		})
+	}
+	return peers
+}
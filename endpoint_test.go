@@ -0,0 +1,160 @@
+package wgquick
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func stubLookupIP(t *testing.T, records map[string][]net.IP) {
+	orig := lookupIP
+	lookupIP = func(host string) ([]net.IP, error) {
+		ips, ok := records[host]
+		if !ok {
+			return nil, fmt.Errorf("no such host %s", host)
+		}
+		return ips, nil
+	}
+	t.Cleanup(func() { lookupIP = orig })
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	stubLookupIP(t, map[string][]net.IP{
+		"vpn.example.com": {net.ParseIP("fd00::1"), net.ParseIP("192.0.2.1")},
+		"v6.example.com":  {net.ParseIP("fd00::2")},
+	})
+
+	addr, err := resolveEndpoint("vpn.example.com:51820", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1:51820", addr.String())
+
+	addr, err = resolveEndpoint("vpn.example.com:51820", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "[fd00::1]:51820", addr.String())
+
+	addr, err = resolveEndpoint("v6.example.com:51820", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "[fd00::2]:51820", addr.String())
+
+	addr, err = resolveEndpoint("[fd00::3]:51820", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "[fd00::3]:51820", addr.String())
+
+	_, err = resolveEndpoint("missing.example.com:51820", false)
+	assert.True(t, errors.Is(err, ErrEndpointResolve))
+	assert.Contains(t, err.Error(), "missing.example.com:51820")
+
+	_, err = resolveEndpoint("vpn.example.com", false)
+	assert.True(t, errors.Is(err, ErrEndpointResolve))
+}
+
+func TestEndpointHostname(t *testing.T) {
+	records := map[string][]net.IP{
+		"vpn.example.com": {net.ParseIP("192.0.2.1"), net.ParseIP("fd00::1")},
+	}
+	stubLookupIP(t, records)
+
+	c := &Config{}
+	err := c.UnmarshalText([]byte(`[Interface]
+Address = fd00:1::2/64
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+Endpoint = vpn.example.com:51820
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = ::/0
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "[fd00::1]:51820", c.Peers[0].Endpoint.String())
+	assert.Equal(t, "vpn.example.com:51820", c.EndpointHosts[c.Peers[0].PublicKey])
+
+	b, err := c.MarshalText()
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "Endpoint = vpn.example.com:51820")
+
+	records["vpn.example.com"] = []net.IP{net.ParseIP("fd00::9")}
+	assert.NoError(t, c.ResolveEndpoints())
+	assert.Equal(t, "[fd00::9]:51820", c.Peers[0].Endpoint.String())
+
+	delete(records, "vpn.example.com")
+	err = c.ResolveEndpoints()
+	assert.True(t, errors.Is(err, ErrEndpointResolve))
+}
+
+func TestEndpointResolveError(t *testing.T) {
+	stubLookupIP(t, nil)
+
+	c := &Config{}
+	err := c.UnmarshalText([]byte(`[Interface]
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+Endpoint = missing.example.com:51820
+`))
+	assert.True(t, errors.Is(err, ErrEndpointResolve))
+	assert.Contains(t, err.Error(), "[line 6]")
+}
+
+func TestChangedEndpoints(t *testing.T) {
+	stubLookupIP(t, map[string][]net.IP{
+		"same.example.com":  {net.ParseIP("192.0.2.1")},
+		"moved.example.com": {net.ParseIP("192.0.2.3")},
+	})
+	same, err := ParseKey("GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=")
+	assert.NoError(t, err)
+	moved, err := ParseKey("xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=")
+	assert.NoError(t, err)
+	broken, err := ParseKey("TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=")
+	assert.NoError(t, err)
+
+	hosts := map[wgtypes.Key]string{
+		same:   "same.example.com:51820",
+		moved:  "moved.example.com:51820",
+		broken: "broken.example.com:51820",
+	}
+	endpoints := map[wgtypes.Key]string{
+		same:   "192.0.2.1:51820",
+		moved:  "192.0.2.2:51820",
+		broken: "192.0.2.4:51820",
+	}
+	peers := changedEndpoints(hosts, endpoints, false, zap.NewNop())
+	if assert.Len(t, peers, 1) {
+		assert.Equal(t, moved, peers[0].PublicKey)
+		assert.True(t, peers[0].UpdateOnly)
+		assert.Equal(t, "192.0.2.3:51820", peers[0].Endpoint.String())
+	}
+}
+
+func TestEndpointIPv6(t *testing.T) {
+	c := &Config{}
+	err := c.UnmarshalText([]byte(`[Interface]
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+Endpoint = [fd00::1]:51820
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, net.ParseIP("fd00::1"), c.Peers[0].Endpoint.IP)
+	assert.Equal(t, 51820, c.Peers[0].Endpoint.Port)
+
+	b, err := c.MarshalText()
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "Endpoint = [fd00::1]:51820\n")
+
+	// without brackets the port can't be told apart from the address
+	err = c.UnmarshalText([]byte(`[Interface]
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+Endpoint = fd00::1:51820
+`))
+	assert.True(t, errors.Is(err, ErrEndpointResolve))
+}
@@ -0,0 +1,55 @@
+package wgquick
+
+import "errors"
+
+// Sentinel errors describing which step of Up/Down/Sync failed. Use errors.Is to check for them, the underlying error is still available via errors.Unwrap
+var (
+	ErrLinkCreate = errors.New("cannot create link")
+	ErrLinkSync   = errors.New("cannot sync link")
+	ErrLinkDelete = errors.New("cannot delete link")
+	ErrDeviceSync = errors.New("cannot sync wireguard device")
+	ErrAddrSync   = errors.New("cannot sync addresses")
+	ErrRouteSync  = errors.New("cannot sync routes")
+	ErrRuleSync   = errors.New("cannot sync rules")
+	ErrHook       = errors.New("hook failed")
+	ErrDNS        = errors.New("cannot configure DNS")
+	ErrSaveConfig = errors.New("cannot save config")
+)
+
+// ErrNotWireguard is returned when the interface exists, but isn't a wireguard device, so it would be configured by wireguard under a different name than the link
+var ErrNotWireguard = errors.New("link is not a wireguard device")
+
+// ErrModuleNotLoaded is returned when the link can't be created because the wireguard kernel module isn't available and Userspace isn't set.
+// Load it with `modprobe wireguard`, or fall back to a userspace implementation. The netlink error is still available via errors.Unwrap
+var ErrModuleNotLoaded = errors.New("wireguard kernel module not loaded")
+
+// ErrResolvconfNotFound is returned when DNS is configured but resolvconf(8) isn't available on the system
+var ErrResolvconfNotFound = errors.New("resolvconf not found in PATH")
+
+// ErrNotSupported is returned for features not available on the current platform
+var ErrNotSupported = errors.New("not supported on this platform")
+
+// StepError wraps an error with the step which failed
+type StepError struct {
+	// Step is one of the sentinel errors above, or os.ErrExist when Up finds an interface it cannot compare with the config
+	Step error
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return e.Step.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the failed step
+func (e *StepError) Is(target error) bool {
+	return target == e.Step
+}
+
+func stepError(step error, err error) error {
+	return &StepError{Step: step, Err: err}
+}
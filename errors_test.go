@@ -0,0 +1,31 @@
+package wgquick
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepError(t *testing.T) {
+	err := stepError(ErrRouteSync, syscall.EEXIST)
+	assert.True(t, errors.Is(err, ErrRouteSync))
+	assert.True(t, errors.Is(err, syscall.EEXIST))
+	assert.False(t, errors.Is(err, ErrAddrSync))
+	assert.EqualError(t, err, "cannot sync routes: file exists")
+
+	var stepErr *StepError
+	if assert.True(t, errors.As(err, &stepErr)) {
+		assert.Equal(t, ErrRouteSync, stepErr.Step)
+	}
+}
+
+func TestModuleNotLoaded(t *testing.T) {
+	nlErr := errors.New("operation not supported")
+	err := stepError(ErrLinkCreate, stepError(ErrModuleNotLoaded, nlErr))
+	assert.True(t, errors.Is(err, ErrLinkCreate))
+	assert.True(t, errors.Is(err, ErrModuleNotLoaded))
+	assert.True(t, errors.Is(err, nlErr))
+	assert.EqualError(t, err, "cannot create link: wireguard kernel module not loaded: operation not supported")
+}
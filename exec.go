@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+package wgquick
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// execSh runs each line of command on its own with cfg's CommandRunner, stopping at the first failure
+func execSh(ctx context.Context, cfg *Config, command string, iface string, log *zap.Logger, stdin ...string) error {
+	for _, line := range hookLines(command) {
+		line = strings.ReplaceAll(line, "%i", iface)
+		if err := cfg.apply(log, "exec", line, func() error {
+			return execCommand(ctx, cfg.runner(), line, log, strings.Join(stdin, ""))
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func execCommand(ctx context.Context, runner CommandRunner, command string, log *zap.Logger, stdin string) error {
+	if stdin != "" {
+		log = log.With(zap.String("stdin", stdin))
+	}
+	out, err := runner.Run(ctx, command, stdin)
+	if err != nil {
+		log.Error("failed to execute",
+			zap.String("cmd", command),
+			zap.ByteString("output", out),
+			zap.Error(err),
+		)
+		return err
+	}
+	log.Info("executed",
+		zap.String("cmd", command),
+		zap.ByteString("output", out),
+	)
+	return nil
+}
+
+// Run runs command with `sh -ce`
+func (ShellRunner) Run(ctx context.Context, command string, stdin string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-ce", command)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	return cmd.CombinedOutput()
+}
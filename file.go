@@ -0,0 +1,105 @@
+package wgquick
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// LoadConfigFile reads and parses wg-quick config file at path. Since the config holds the private key, the file must not be world accessible
+func LoadConfigFile(path string) (*Config, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode().Perm()&0007 != 0 {
+		return nil, fmt.Errorf("%s is world accessible (mode %v), refusing to load private key", path, fi.Mode().Perm())
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := cfg.UnmarshalText(b); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", path, err)
+	}
+	cfg.ConfigFile = path
+	return cfg, nil
+}
+
+// ifaceNameRe is what wg-quick accepts as interface name
+var ifaceNameRe = regexp.MustCompile(`^[a-zA-Z0-9_=+.-]{1,15}$`)
+
+// LoadInterface is LoadConfigFile also returning the interface name derived from the file name like wg-quick does, e.g. wg0 for /etc/wireguard/wg0.conf
+func LoadInterface(path string) (*Config, string, error) {
+	iface := strings.TrimSuffix(filepath.Base(path), ".conf")
+	if !ifaceNameRe.MatchString(iface) {
+		return nil, "", fmt.Errorf("%s is not a valid interface name", iface)
+	}
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, iface, nil
+}
+
+// loadPrivateKeyFile sets PrivateKey from PrivateKeyFile, if any. Like LoadConfigFile, it refuses world accessible files
+func (cfg *Config) loadPrivateKeyFile() error {
+	if cfg.PrivateKeyFile == "" {
+		return nil
+	}
+	fi, err := os.Stat(cfg.PrivateKeyFile)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Perm()&0007 != 0 {
+		return fmt.Errorf("%s is world accessible (mode %v), refusing to load private key", cfg.PrivateKeyFile, fi.Mode().Perm())
+	}
+	b, err := ioutil.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return err
+	}
+	key, err := ParseKey(strings.TrimSpace(string(b)))
+	if err != nil {
+		return fmt.Errorf("cannot decode key in %s: %v", cfg.PrivateKeyFile, err)
+	}
+	cfg.PrivateKey = &key
+	return nil
+}
+
+// WriteConfigFile atomically writes the config to path with 0600 permissions
+func (cfg *Config) WriteConfigFile(path string) error {
+	b, err := cfg.MarshalText()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// writeFileAtomic writes b to path with 0600 permissions through a temporary file, so readers never see a partial file
+func writeFileAtomic(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op after successful rename
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,95 @@
+package wgquick
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-go")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wg0.conf")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(testConfigs["simple"]), 0600))
+	cfg, err := LoadConfigFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testConfigs["simple"], cfg.String())
+	}
+
+	assert.NoError(t, os.Chmod(path, 0644))
+	_, err = LoadConfigFile(path)
+	assert.Error(t, err)
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-go")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(testConfigs["sample-2"])))
+	path := filepath.Join(dir, "wg0.conf")
+	assert.NoError(t, cfg.WriteConfigFile(path))
+
+	fi, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+	loaded, err := LoadConfigFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testConfigs["sample-2"], loaded.String())
+	}
+}
+
+func TestPrivateKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-go")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wg0.key")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=\n"), 0600))
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte("[Interface]\nPrivateKeyFile = "+path+"\n")))
+	assert.Nil(t, cfg.PrivateKey)
+	assert.NoError(t, cfg.Validate())
+
+	assert.NoError(t, cfg.loadPrivateKeyFile())
+	if assert.NotNil(t, cfg.PrivateKey) {
+		assert.Equal(t, "oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=", cfg.PrivateKey.String())
+	}
+	// the secret stays out of the marshaled config
+	assert.Equal(t, "[Interface]\nPrivateKeyFile = "+path+"\n", cfg.String())
+
+	assert.NoError(t, os.Chmod(path, 0644))
+	assert.Error(t, cfg.loadPrivateKeyFile())
+}
+
+func TestLoadInterface(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-go")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wg0.conf")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(testConfigs["simple"]), 0600))
+	cfg, iface, err := LoadInterface(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "wg0", iface)
+		assert.Equal(t, path, cfg.ConfigFile)
+	}
+
+	_, _, err = LoadInterface(filepath.Join(dir, "much-too-long-name.conf"))
+	assert.EqualError(t, err, "much-too-long-name is not a valid interface name")
+}
@@ -3,10 +3,11 @@ module github.com/uinta-labs/wg-quick-go
 go 1.15
 
 require (
-	github.com/sirupsen/logrus v1.4.2 // indirect
+	github.com/stretchr/testify v1.4.0
 	github.com/vishvananda/netlink v1.0.0
-	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df // indirect
+	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df
 	go.uber.org/zap v1.13.0
 	golang.org/x/sys v0.0.0-20191206220618-eeba5f6aabab
 	golang.zx2c4.com/wireguard/wgctrl v0.0.0-20191205174707-786493d6718c
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
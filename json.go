@@ -0,0 +1,334 @@
+package wgquick
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var _ json.Marshaler = (*Config)(nil)
+var _ json.Unmarshaler = (*Config)(nil)
+
+// encodedConfig is JSON/YAML representation of the Config. Keys are base64 strings, addresses are strings in CIDR notation and durations are in seconds
+type encodedConfig struct {
+	PrivateKey     string                        `json:"PrivateKey,omitempty" yaml:"PrivateKey,omitempty"`
+	PrivateKeyFile string                        `json:"PrivateKeyFile,omitempty" yaml:"PrivateKeyFile,omitempty"`
+	ListenPort     *int                          `json:"ListenPort,omitempty" yaml:"ListenPort,omitempty"`
+	FwMark         *int                          `json:"FwMark,omitempty" yaml:"FwMark,omitempty"`
+	Address        []string                      `json:"Address,omitempty" yaml:"Address,omitempty"`
+	DNS            []string                      `json:"DNS,omitempty" yaml:"DNS,omitempty"`
+	SearchDomains  []string                      `json:"SearchDomains,omitempty" yaml:"SearchDomains,omitempty"`
+	DNSBackend     DNSBackend                    `json:"DNSBackend,omitempty" yaml:"DNSBackend,omitempty"`
+	MTU            int                           `json:"MTU,omitempty" yaml:"MTU,omitempty"`
+	MTUOverhead    int                           `json:"MTUOverhead,omitempty" yaml:"MTUOverhead,omitempty"`
+	Table          int                           `json:"Table,omitempty" yaml:"Table,omitempty"`
+	PreUp          string                        `json:"PreUp,omitempty" yaml:"PreUp,omitempty"`
+	PostUp         string                        `json:"PostUp,omitempty" yaml:"PostUp,omitempty"`
+	PreDown        string                        `json:"PreDown,omitempty" yaml:"PreDown,omitempty"`
+	PostDown       string                        `json:"PostDown,omitempty" yaml:"PostDown,omitempty"`
+	RouteProtocol  int                           `json:"RouteProtocol,omitempty" yaml:"RouteProtocol,omitempty"`
+	RouteMetric    int                           `json:"RouteMetric,omitempty" yaml:"RouteMetric,omitempty"`
+	RulePriority   int                           `json:"RulePriority,omitempty" yaml:"RulePriority,omitempty"`
+	ExcludedRoutes []string                      `json:"ExcludedRoutes,omitempty" yaml:"ExcludedRoutes,omitempty"`
+	Routes         []encodedRoute                `json:"Routes,omitempty" yaml:"Routes,omitempty"`
+	Rules          []encodedRule                 `json:"Rules,omitempty" yaml:"Rules,omitempty"`
+	PreserveRoutes bool                          `json:"PreserveRoutes,omitempty" yaml:"PreserveRoutes,omitempty"`
+	RouteConflict  RouteConflictPolicy           `json:"RouteConflict,omitempty" yaml:"RouteConflict,omitempty"`
+	AddressLabel   string                        `json:"AddressLabel,omitempty" yaml:"AddressLabel,omitempty"`
+	AddressSpecs   map[string]encodedAddressSpec `json:"AddressSpecs,omitempty" yaml:"AddressSpecs,omitempty"`
+	Userspace      string                        `json:"Userspace,omitempty" yaml:"Userspace,omitempty"`
+	Namespace      string                        `json:"Namespace,omitempty" yaml:"Namespace,omitempty"`
+	SaveConfig     bool                          `json:"SaveConfig,omitempty" yaml:"SaveConfig,omitempty"`
+	Peers          []encodedPeer                 `json:"Peers,omitempty" yaml:"Peers,omitempty"`
+}
+
+type encodedAddressSpec struct {
+	Scope int    `json:"Scope,omitempty" yaml:"Scope,omitempty"`
+	Label string `json:"Label,omitempty" yaml:"Label,omitempty"`
+}
+
+type encodedRoute struct {
+	Dst       string `json:"Dst" yaml:"Dst"`
+	Gw        string `json:"Gw,omitempty" yaml:"Gw,omitempty"`
+	Blackhole bool   `json:"Blackhole,omitempty" yaml:"Blackhole,omitempty"`
+	Table     int    `json:"Table,omitempty" yaml:"Table,omitempty"`
+	Metric    int    `json:"Metric,omitempty" yaml:"Metric,omitempty"`
+}
+
+type encodedRule struct {
+	Src      string `json:"Src,omitempty" yaml:"Src,omitempty"`
+	Dst      string `json:"Dst,omitempty" yaml:"Dst,omitempty"`
+	FwMark   int    `json:"FwMark,omitempty" yaml:"FwMark,omitempty"`
+	Table    int    `json:"Table" yaml:"Table"`
+	Priority int    `json:"Priority,omitempty" yaml:"Priority,omitempty"`
+}
+
+type encodedPeer struct {
+	PublicKey           string   `json:"PublicKey" yaml:"PublicKey"`
+	PresharedKey        string   `json:"PresharedKey,omitempty" yaml:"PresharedKey,omitempty"`
+	AllowedIPs          []string `json:"AllowedIPs,omitempty" yaml:"AllowedIPs,omitempty"`
+	Endpoint            string   `json:"Endpoint,omitempty" yaml:"Endpoint,omitempty"`
+	PersistentKeepalive int      `json:"PersistentKeepalive,omitempty" yaml:"PersistentKeepalive,omitempty"`
+	Table               int      `json:"Table,omitempty" yaml:"Table,omitempty"`
+	Name                string   `json:"Name,omitempty" yaml:"Name,omitempty"`
+	Comments            []string `json:"Comments,omitempty" yaml:"Comments,omitempty"`
+}
+
+// MarshalJSON encodes the config as JSON. ConfigFile isn't included
+func (cfg *Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cfg.encode())
+}
+
+// UnmarshalJSON decodes the config from JSON produced by MarshalJSON
+func (cfg *Config) UnmarshalJSON(b []byte) error {
+	var ec encodedConfig
+	if err := json.Unmarshal(b, &ec); err != nil {
+		return err
+	}
+	return cfg.decode(&ec)
+}
+
+func (cfg *Config) encode() *encodedConfig {
+	ec := &encodedConfig{
+		ListenPort:     cfg.ListenPort,
+		FwMark:         cfg.FirewallMark,
+		MTU:            cfg.MTU,
+		MTUOverhead:    cfg.MTUOverhead,
+		Table:          cfg.Table,
+		PreUp:          cfg.PreUp,
+		PostUp:         cfg.PostUp,
+		PreDown:        cfg.PreDown,
+		PostDown:       cfg.PostDown,
+		RouteProtocol:  cfg.RouteProtocol,
+		RouteMetric:    cfg.RouteMetric,
+		RulePriority:   cfg.RulePriority,
+		PreserveRoutes: cfg.PreserveRoutes,
+		RouteConflict:  cfg.RouteConflict,
+		SearchDomains:  cfg.SearchDomains,
+		DNSBackend:     cfg.DNSBackend,
+		AddressLabel:   cfg.AddressLabel,
+		Userspace:      cfg.Userspace,
+		Namespace:      cfg.Namespace,
+		SaveConfig:     cfg.SaveConfig,
+	}
+	if cfg.PrivateKeyFile != "" {
+		ec.PrivateKeyFile = cfg.PrivateKeyFile
+	} else if cfg.PrivateKey != nil {
+		ec.PrivateKey = serializeKey(cfg.PrivateKey)
+	}
+	for _, addr := range cfg.Address {
+		ec.Address = append(ec.Address, addr.String())
+	}
+	for addr, spec := range cfg.AddressSpecs {
+		if ec.AddressSpecs == nil {
+			ec.AddressSpecs = make(map[string]encodedAddressSpec)
+		}
+		ec.AddressSpecs[addr] = encodedAddressSpec(spec)
+	}
+	for _, dns := range cfg.DNS {
+		ec.DNS = append(ec.DNS, dns.String())
+	}
+	for _, ex := range cfg.ExcludedRoutes {
+		ec.ExcludedRoutes = append(ec.ExcludedRoutes, ex.String())
+	}
+	for _, r := range cfg.Routes {
+		er := encodedRoute{
+			Dst:       r.Dst.String(),
+			Blackhole: r.Blackhole,
+			Table:     r.Table,
+			Metric:    r.Metric,
+		}
+		if r.Gw != nil {
+			er.Gw = r.Gw.String()
+		}
+		ec.Routes = append(ec.Routes, er)
+	}
+	for _, r := range cfg.Rules {
+		ec.Rules = append(ec.Rules, encodedRule{
+			Src:      ipNetString(r.Src),
+			Dst:      ipNetString(r.Dst),
+			FwMark:   r.Mark,
+			Table:    r.Table,
+			Priority: r.Priority,
+		})
+	}
+	for _, peer := range cfg.Peers {
+		ep := encodedPeer{
+			PublicKey: serializeKey(&peer.PublicKey),
+		}
+		if peer.PresharedKey != nil {
+			ep.PresharedKey = serializeKey(peer.PresharedKey)
+		}
+		for _, ip := range peer.AllowedIPs {
+			ep.AllowedIPs = append(ep.AllowedIPs, ip.String())
+		}
+		ep.Endpoint = cfg.endpointString(peer)
+		if peer.PersistentKeepaliveInterval != nil {
+			ep.PersistentKeepalive = toSeconds(*peer.PersistentKeepaliveInterval)
+		}
+		ep.Table = cfg.PeerTables[peer.PublicKey]
+		ep.Name = cfg.PeerNames[peer.PublicKey]
+		ep.Comments = cfg.PeerComments[peer.PublicKey]
+		ec.Peers = append(ec.Peers, ep)
+	}
+	return ec
+}
+
+func (cfg *Config) decode(ec *encodedConfig) error {
+	*cfg = Config{
+		MTU:            ec.MTU,
+		MTUOverhead:    ec.MTUOverhead,
+		Table:          ec.Table,
+		PreUp:          ec.PreUp,
+		PostUp:         ec.PostUp,
+		PreDown:        ec.PreDown,
+		PostDown:       ec.PostDown,
+		RouteProtocol:  ec.RouteProtocol,
+		RouteMetric:    ec.RouteMetric,
+		RulePriority:   ec.RulePriority,
+		PreserveRoutes: ec.PreserveRoutes,
+		RouteConflict:  ec.RouteConflict,
+		SearchDomains:  ec.SearchDomains,
+		DNSBackend:     ec.DNSBackend,
+		AddressLabel:   ec.AddressLabel,
+		Userspace:      ec.Userspace,
+		Namespace:      ec.Namespace,
+		PrivateKeyFile: ec.PrivateKeyFile,
+		SaveConfig:     ec.SaveConfig,
+	}
+	cfg.ListenPort = ec.ListenPort
+	cfg.FirewallMark = ec.FwMark
+	if ec.PrivateKey != "" {
+		key, err := ParseKey(ec.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("cannot decode key %v", err)
+		}
+		cfg.PrivateKey = &key
+	}
+	for _, addr := range ec.Address {
+		ipNet, err := parseIPNet(addr)
+		if err != nil {
+			return err
+		}
+		cfg.Address = append(cfg.Address, ipNet)
+	}
+	for addr, spec := range ec.AddressSpecs {
+		ipNet, err := parseIPNet(addr)
+		if err != nil {
+			return err
+		}
+		if cfg.AddressSpecs == nil {
+			cfg.AddressSpecs = make(map[string]AddressSpec)
+		}
+		cfg.AddressSpecs[ipNet.String()] = AddressSpec(spec)
+	}
+	for _, addr := range ec.DNS {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fmt.Errorf("cannot parse IP %s", addr)
+		}
+		cfg.DNS = append(cfg.DNS, ip)
+	}
+	for _, ex := range ec.ExcludedRoutes {
+		_, n, err := net.ParseCIDR(ex)
+		if err != nil {
+			return fmt.Errorf("cannot parse %s: %v", ex, err)
+		}
+		cfg.ExcludedRoutes = append(cfg.ExcludedRoutes, *n)
+	}
+	for _, er := range ec.Routes {
+		_, dst, err := net.ParseCIDR(er.Dst)
+		if err != nil {
+			return fmt.Errorf("cannot parse %s: %v", er.Dst, err)
+		}
+		r := Route{
+			Dst:       *dst,
+			Blackhole: er.Blackhole,
+			Table:     er.Table,
+			Metric:    er.Metric,
+		}
+		if er.Gw != "" {
+			r.Gw = net.ParseIP(er.Gw)
+			if r.Gw == nil {
+				return fmt.Errorf("cannot parse IP %s", er.Gw)
+			}
+		}
+		cfg.Routes = append(cfg.Routes, r)
+	}
+	for _, er := range ec.Rules {
+		r := Rule{
+			Mark:     er.FwMark,
+			Table:    er.Table,
+			Priority: er.Priority,
+		}
+		if er.Src != "" {
+			_, src, err := net.ParseCIDR(er.Src)
+			if err != nil {
+				return fmt.Errorf("cannot parse %s: %v", er.Src, err)
+			}
+			r.Src = src
+		}
+		if er.Dst != "" {
+			_, dst, err := net.ParseCIDR(er.Dst)
+			if err != nil {
+				return fmt.Errorf("cannot parse %s: %v", er.Dst, err)
+			}
+			r.Dst = dst
+		}
+		cfg.Rules = append(cfg.Rules, r)
+	}
+	for _, ep := range ec.Peers {
+		var peer wgtypes.PeerConfig
+		key, err := ParseKey(ep.PublicKey)
+		if err != nil {
+			return fmt.Errorf("cannot decode key %v", err)
+		}
+		peer.PublicKey = key
+		if ep.PresharedKey != "" {
+			psk, err := ParseKey(ep.PresharedKey)
+			if err != nil {
+				return fmt.Errorf("cannot decode key %v", err)
+			}
+			peer.PresharedKey = &psk
+		}
+		for _, addr := range ep.AllowedIPs {
+			ipNet, err := parseAllowedIP(addr)
+			if err != nil {
+				return fmt.Errorf("cannot parse AllowedIPs %q: %v", addr, err)
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, ipNet)
+		}
+		if ep.Endpoint != "" {
+			if err := cfg.setEndpoint(&peer, ep.Endpoint); err != nil {
+				return err
+			}
+		}
+		if ep.PersistentKeepalive != 0 {
+			keepalive := time.Duration(ep.PersistentKeepalive) * time.Second
+			peer.PersistentKeepaliveInterval = &keepalive
+		}
+		if ep.Table != 0 {
+			if cfg.PeerTables == nil {
+				cfg.PeerTables = make(map[wgtypes.Key]int)
+			}
+			cfg.PeerTables[peer.PublicKey] = ep.Table
+		}
+		if ep.Name != "" {
+			if cfg.PeerNames == nil {
+				cfg.PeerNames = make(map[wgtypes.Key]string)
+			}
+			cfg.PeerNames[peer.PublicKey] = ep.Name
+		}
+		if len(ep.Comments) > 0 {
+			if cfg.PeerComments == nil {
+				cfg.PeerComments = make(map[wgtypes.Key][]string)
+			}
+			cfg.PeerComments[peer.PublicKey] = ep.Comments
+		}
+		cfg.Peers = append(cfg.Peers, peer)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package wgquick
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	for name, cfg := range testConfigs {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			assert.NoError(t, c.UnmarshalText([]byte(cfg)))
+			b, err := json.Marshal(c)
+			assert.NoError(t, err)
+			t.Logf("Got JSON:\n%s", b)
+
+			c2 := &Config{}
+			assert.NoError(t, json.Unmarshal(b, c2))
+			assert.Equal(t, cfg, c2.String())
+		})
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(testConfigs["sample-3"])))
+	b, err := json.Marshal(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"PrivateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=",
+		"ListenPort": 51820,
+		"Address": ["10.192.122.1/24"],
+		"Table": 1234,
+		"PostUp": "ip rule add ipproto tcp dport 22 table 1234",
+		"PreDown": "ip rule delete ipproto tcp dport 22 table 1234",
+		"Peers": [{
+			"PublicKey": "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=",
+			"AllowedIPs": ["0.0.0.0/0"],
+			"PersistentKeepalive": 25
+		}]
+	}`, string(b))
+}
+
+func TestJSONAddressSpecs(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"PrivateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=",
+		"Address": ["10.0.0.1/24", "fd00::1/64"],
+		"AddressSpecs": {"fd00::1/64": {"Scope": 253, "Label": "wg0:lan"}}
+	}`), c))
+	assert.Equal(t, map[string]AddressSpec{"fd00::1/64": {Scope: 253, Label: "wg0:lan"}}, c.AddressSpecs)
+	assert.NoError(t, c.Validate())
+
+	b, err := json.Marshal(c)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"AddressSpecs":{"fd00::1/64":{"Scope":253,"Label":"wg0:lan"}}`)
+
+	c.AddressSpecs = map[string]AddressSpec{"10.0.0.2/24": {Scope: 253}}
+	assert.EqualError(t, c.Validate(), "invalid config: address spec 10.0.0.2/24 doesn't match any Address")
+}
@@ -0,0 +1,14 @@
+package wgquick
+
+import "sync"
+
+// ifaceLocks holds a *sync.Mutex per interface (and namespace), so concurrent Up, Sync, Down and peer changes on the same interface don't interleave
+var ifaceLocks sync.Map
+
+// lockIface blocks until no other operation runs on iface, call the returned func to release it
+func lockIface(cfg *Config, iface string) (unlock func()) {
+	l, _ := ifaceLocks.LoadOrStore(cfg.Namespace+"/"+iface, &sync.Mutex{})
+	mu := l.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
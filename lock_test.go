@@ -0,0 +1,33 @@
+package wgquick
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockIface(t *testing.T) {
+	unlock := lockIface(&Config{}, "wg0")
+
+	locked := make(chan struct{})
+	go func() {
+		defer lockIface(&Config{}, "wg0")()
+		close(locked)
+	}()
+	// other interfaces and namespaces aren't blocked
+	lockIface(&Config{}, "wg1")()
+	lockIface(&Config{Namespace: "ns"}, "wg0")()
+
+	select {
+	case <-locked:
+		t.Fatal("second lock on the same interface acquired")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		assert.Fail(t, "second lock not acquired after unlock")
+	}
+}
@@ -0,0 +1,11 @@
+package wgquick
+
+import "go.uber.org/zap"
+
+// ifaceLogger scopes the logger to the interface. Nil logger discards all logs
+func ifaceLogger(logger *zap.Logger, iface string) *zap.Logger {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return logger.With(zap.String("iface", iface))
+}
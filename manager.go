@@ -0,0 +1,199 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Manager owns a set of interfaces, e.g. for daemons managing many tunnels. It remembers the config each interface was brought up with,
+// so Down and Stats only need the name. Operations on the same interface are serialized, see Up, Sync and Down.
+// Interfaces sharing a lifecycle, e.g. the tunnels of a site-to-site mesh, can be tagged into groups and brought up or down together.
+type Manager struct {
+	logger *zap.Logger
+
+	mu     sync.Mutex
+	ifaces map[string]*Config
+	// groups holds the members of each group
+	groups map[string]map[string]bool
+}
+
+// NewManager creates a Manager without interfaces. Nil logger discards all logs
+func NewManager(logger *zap.Logger) *Manager {
+	return &Manager{
+		logger: logger,
+		ifaces: make(map[string]*Config),
+		groups: make(map[string]map[string]bool),
+	}
+}
+
+// Up brings up the interface with UpContext and takes ownership of it. The Manager keeps a copy of cfg
+func (m *Manager) Up(ctx context.Context, cfg *Config, iface string) error {
+	if err := UpContext(ctx, cfg, iface, m.logger); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ifaces[iface] = cfg.Clone()
+	return nil
+}
+
+// Sync converges an owned interface to cfg with Sync, and keeps a copy of cfg for later operations
+func (m *Manager) Sync(cfg *Config, iface string) error {
+	if _, err := m.config(iface); err != nil {
+		return err
+	}
+	if err := Sync(cfg, iface, m.logger); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ifaces[iface] = cfg.Clone()
+	return nil
+}
+
+// Down tears down an owned interface with DownContext, using the config it was brought up or last synced with, and releases it
+func (m *Manager) Down(ctx context.Context, iface string) error {
+	cfg, err := m.config(iface)
+	if err != nil {
+		return err
+	}
+	if err := DownContext(ctx, cfg, iface, m.logger); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.ifaces, iface)
+	for group, members := range m.groups {
+		delete(members, iface)
+		if len(members) == 0 {
+			delete(m.groups, group)
+		}
+	}
+	return nil
+}
+
+// Tag adds an owned interface to groups. An interface leaves its groups when it's brought down
+func (m *Manager) Tag(iface string, groups ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.ifaces[iface]; !ok {
+		return fmt.Errorf("interface %s not managed", iface)
+	}
+	for _, group := range groups {
+		if m.groups[group] == nil {
+			m.groups[group] = make(map[string]bool)
+		}
+		m.groups[group][iface] = true
+	}
+	return nil
+}
+
+// Group returns the names of the interfaces in group, sorted
+func (m *Manager) Group(group string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ifaces := make([]string, 0, len(m.groups[group]))
+	for iface := range m.groups[group] {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	return ifaces
+}
+
+// UpGroup brings up each interface of cfgs, by interface name, in name order with Up and tags it with group.
+// If one fails, the interfaces brought up before it are brought down again, so the group comes up as a whole or not at all
+func (m *Manager) UpGroup(ctx context.Context, group string, cfgs map[string]*Config) error {
+	ifaces := make([]string, 0, len(cfgs))
+	for iface := range cfgs {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+
+	for i, iface := range ifaces {
+		err := m.Up(ctx, cfgs[iface], iface)
+		if err == nil {
+			err = m.Tag(iface, group)
+		}
+		if err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if err := m.Down(ctx, ifaces[j]); err != nil {
+					ifaceLogger(m.logger, ifaces[j]).Error("cannot roll back group", zap.String("group", group), zap.Error(err))
+				}
+			}
+			return fmt.Errorf("%s: %w", iface, err)
+		}
+	}
+	return nil
+}
+
+// DownGroup brings down all interfaces of group with Down. Failures don't stop the others from going down, the first one is returned
+func (m *Manager) DownGroup(ctx context.Context, group string) error {
+	var first error
+	for _, iface := range m.Group(group) {
+		if err := m.Down(ctx, iface); err != nil {
+			ifaceLogger(m.logger, iface).Error("cannot bring down group member", zap.String("group", group), zap.Error(err))
+			if first == nil {
+				first = fmt.Errorf("%s: %w", iface, err)
+			}
+		}
+	}
+	return first
+}
+
+// List returns the names of owned interfaces, sorted
+func (m *Manager) List() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ifaces := make([]string, 0, len(m.ifaces))
+	for iface := range m.ifaces {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	return ifaces
+}
+
+// Config returns a copy of the config an owned interface was brought up or last synced with
+func (m *Manager) Config(iface string) (*Config, error) {
+	cfg, err := m.config(iface)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Clone(), nil
+}
+
+// Stats returns peer stats of all owned interfaces, by interface name. Interfaces which can't be read are logged and left out
+func (m *Manager) Stats() map[string][]PeerStats {
+	stats := make(map[string][]PeerStats)
+	for _, iface := range m.List() {
+		cfg, err := m.config(iface)
+		if err != nil {
+			// went down meanwhile
+			continue
+		}
+		if err := inNamespace(cfg, func() error {
+			s, err := Stats(iface)
+			if err != nil {
+				return err
+			}
+			stats[iface] = s
+			return nil
+		}); err != nil {
+			ifaceLogger(m.logger, iface).Error("cannot read stats", zap.Error(err))
+		}
+	}
+	return stats
+}
+
+func (m *Manager) config(iface string) (*Config, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg, ok := m.ifaces[iface]
+	if !ok {
+		return nil, fmt.Errorf("interface %s not managed", iface)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,41 @@
+package wgquick
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagerNotManaged(t *testing.T) {
+	m := NewManager(nil)
+	assert.Empty(t, m.List())
+	assert.Empty(t, m.Stats())
+	assert.EqualError(t, m.Down(context.Background(), "wg0"), "interface wg0 not managed")
+	assert.EqualError(t, m.Sync(&Config{}, "wg0"), "interface wg0 not managed")
+	_, err := m.Config("wg0")
+	assert.EqualError(t, err, "interface wg0 not managed")
+
+	m.ifaces["wg1"] = &Config{}
+	m.ifaces["wg0"] = &Config{MTU: 1280}
+	assert.Equal(t, []string{"wg0", "wg1"}, m.List())
+	cfg, err := m.Config("wg0")
+	assert.NoError(t, err)
+	cfg.MTU = 1420
+	assert.Equal(t, 1280, m.ifaces["wg0"].MTU)
+}
+
+func TestManagerGroups(t *testing.T) {
+	m := NewManager(nil)
+	assert.EqualError(t, m.Tag("wg0", "mesh"), "interface wg0 not managed")
+	assert.Empty(t, m.Group("mesh"))
+	assert.NoError(t, m.DownGroup(context.Background(), "mesh"))
+
+	m.ifaces["wg1"] = &Config{}
+	m.ifaces["wg0"] = &Config{}
+	assert.NoError(t, m.Tag("wg1", "mesh", "site-a"))
+	assert.NoError(t, m.Tag("wg0", "mesh"))
+	assert.Equal(t, []string{"wg0", "wg1"}, m.Group("mesh"))
+	assert.Equal(t, []string{"wg1"}, m.Group("site-a"))
+	assert.Empty(t, m.Group("site-b"))
+}
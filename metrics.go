@@ -0,0 +1,106 @@
+package wgquick
+
+import (
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// handshakeTimeout is how old the last handshake may get before the peer is considered unreachable.
+// Wireguard renews the session every 2 minutes while there's traffic, and gives up on it after 3 minutes
+const handshakeTimeout = 3 * time.Minute
+
+// Metric is a single sample in the shape of a Prometheus metric, e.g. to be turned into a prometheus.MustNewConstMetric in a custom prometheus.Collector
+type Metric struct {
+	Name string
+	Help string
+	// Counter is true for monotonically increasing values, false for gauges
+	Counter bool
+	Labels  map[string]string
+	Value   float64
+}
+
+// Collector reads per-peer metrics of an interface
+type Collector struct {
+	cfg   *Config
+	iface string
+	now   func() time.Time
+}
+
+// NewCollector creates a Collector for iface, read in cfg's Namespace. A nil cfg means the current namespace. The interface doesn't need to exist yet
+func NewCollector(cfg *Config, iface string) *Collector {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	return &Collector{cfg: cfg, iface: iface, now: time.Now}
+}
+
+// Collect reads the device and returns per-peer metrics, labeled with the interface and the peer's public key:
+// * wireguard_peer_receive_bytes_total and wireguard_peer_transmit_bytes_total
+// * wireguard_peer_last_handshake_age_seconds, left out for peers without a handshake yet
+// * wireguard_peer_up, 1 if the last handshake is recent enough for the session to be alive, also labeled with the endpoint
+func (c *Collector) Collect() ([]Metric, error) {
+	var dev *wgtypes.Device
+	if err := inNamespace(c.cfg, func() (err error) {
+		dev, err = DeviceStatus(c.iface)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return deviceMetrics(dev, c.now()), nil
+}
+
+func deviceMetrics(dev *wgtypes.Device, now time.Time) []Metric {
+	var metrics []Metric
+	for _, p := range peerStats(dev) {
+		labels := map[string]string{
+			"interface":  dev.Name,
+			"public_key": p.PublicKey.String(),
+		}
+		metrics = append(metrics,
+			Metric{
+				Name:    "wireguard_peer_receive_bytes_total",
+				Help:    "Bytes received from the peer",
+				Counter: true,
+				Labels:  labels,
+				Value:   float64(p.ReceiveBytes),
+			},
+			Metric{
+				Name:    "wireguard_peer_transmit_bytes_total",
+				Help:    "Bytes sent to the peer",
+				Counter: true,
+				Labels:  labels,
+				Value:   float64(p.TransmitBytes),
+			},
+		)
+
+		up := 0.0
+		if !p.LastHandshakeTime.IsZero() {
+			age := now.Sub(p.LastHandshakeTime)
+			metrics = append(metrics, Metric{
+				Name:   "wireguard_peer_last_handshake_age_seconds",
+				Help:   "Seconds since the last handshake with the peer",
+				Labels: labels,
+				Value:  age.Seconds(),
+			})
+			if age < handshakeTimeout {
+				up = 1
+			}
+		}
+		upLabels := map[string]string{
+			"interface":  dev.Name,
+			"public_key": p.PublicKey.String(),
+			"endpoint":   "",
+		}
+		if p.Endpoint != nil {
+			upLabels["endpoint"] = p.Endpoint.String()
+		}
+		metrics = append(metrics, Metric{
+			Name:   "wireguard_peer_up",
+			Help:   "Whether the session with the peer is alive, i.e. the last handshake is recent enough",
+			Labels: upLabels,
+			Value:  up,
+		})
+	}
+	return metrics
+}
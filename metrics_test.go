@@ -0,0 +1,59 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestDeviceMetrics(t *testing.T) {
+	pub, err := ParseKey("xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=")
+	assert.NoError(t, err)
+	handshake := time.Date(2019, 12, 6, 12, 0, 0, 0, time.UTC)
+	dev := &wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:         pub,
+				Endpoint:          &net.UDPAddr{IP: net.ParseIP("123.12.12.1"), Port: 51820},
+				LastHandshakeTime: handshake,
+				ReceiveBytes:      1024,
+				TransmitBytes:     2048,
+			},
+		},
+	}
+
+	values := func(metrics []Metric) map[string]float64 {
+		v := make(map[string]float64)
+		for _, m := range metrics {
+			assert.Equal(t, "wg0", m.Labels["interface"])
+			assert.Equal(t, pub.String(), m.Labels["public_key"])
+			v[m.Name] = m.Value
+		}
+		return v
+	}
+
+	metrics := deviceMetrics(dev, handshake.Add(time.Minute))
+	assert.Equal(t, map[string]float64{
+		"wireguard_peer_receive_bytes_total":        1024,
+		"wireguard_peer_transmit_bytes_total":       2048,
+		"wireguard_peer_last_handshake_age_seconds": 60,
+		"wireguard_peer_up":                         1,
+	}, values(metrics))
+	assert.Equal(t, "123.12.12.1:51820", metrics[len(metrics)-1].Labels["endpoint"])
+
+	assert.Equal(t, 0.0, values(deviceMetrics(dev, handshake.Add(10*time.Minute)))["wireguard_peer_up"])
+
+	dev.Peers[0].LastHandshakeTime = time.Time{}
+	v := values(deviceMetrics(dev, handshake))
+	assert.NotContains(t, v, "wireguard_peer_last_handshake_age_seconds")
+	assert.Equal(t, 0.0, v["wireguard_peer_up"])
+}
+
+func TestCollectorNamespace(t *testing.T) {
+	_, err := NewCollector(&Config{Namespace: "wgquick-test-missing"}, "wg0").Collect()
+	assert.Error(t, err, "read outside the namespace")
+}
@@ -0,0 +1,73 @@
+package wgquick
+
+import (
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// endpointOverhead is the per-packet overhead for an endpoint, MTUOverhead if set. A nil ip counts as IPv6, the larger one
+func endpointOverhead(cfg *Config, ip net.IP) int {
+	if cfg.MTUOverhead > 0 {
+		return cfg.MTUOverhead
+	}
+	if ip.To4() != nil {
+		return IPv4Overhead
+	}
+	return IPv6Overhead
+}
+
+// autoMTU discovers the MTU when the config has none, like wg-quick: the largest MTU of the paths to peer endpoints minus the wireguard overhead,
+// or if no endpoint is routable, the MTU of the default route's link minus the IPv6 overhead. See MTUOverhead for extra encapsulation. Routes through link itself are ignored.
+// It's 0 if nothing was found, the link then keeps its MTU
+func autoMTU(cfg *Config, link netlink.Link, log *zap.Logger) int {
+	mtu := 0
+	for _, peer := range cfg.Peers {
+		if peer.Endpoint == nil {
+			continue
+		}
+		routes, err := netlink.RouteGet(peer.Endpoint.IP)
+		if err != nil || len(routes) == 0 {
+			log.Debug("no route to endpoint", zap.String("endpoint", peer.Endpoint.String()), zap.Error(err))
+			continue
+		}
+		if m := routeMTU(routes[0], link); m > 0 && m-endpointOverhead(cfg, peer.Endpoint.IP) > mtu {
+			mtu = m - endpointOverhead(cfg, peer.Endpoint.IP)
+		}
+	}
+	if mtu > 0 {
+		return mtu
+	}
+
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		log.Debug("cannot list routes", zap.Error(err))
+		return 0
+	}
+	for _, rt := range routes {
+		if rt.Dst != nil && !isDefaultRoute(*rt.Dst) {
+			continue
+		}
+		if m := routeMTU(rt, link); m > 0 {
+			return m - endpointOverhead(cfg, nil)
+		}
+	}
+	return 0
+}
+
+// routeMTU is the MTU set on the route, or the MTU of its link
+func routeMTU(rt netlink.Route, link netlink.Link) int {
+	if rt.LinkIndex == 0 || rt.LinkIndex == link.Attrs().Index {
+		return 0
+	}
+	if rt.MTU > 0 {
+		return rt.MTU
+	}
+	l, err := netlink.LinkByIndex(rt.LinkIndex)
+	if err != nil {
+		return 0
+	}
+	return l.Attrs().MTU
+}
@@ -0,0 +1,25 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestEndpointOverhead(t *testing.T) {
+	assert.Equal(t, 60, endpointOverhead(&Config{}, net.ParseIP("123.12.12.1")))
+	assert.Equal(t, 80, endpointOverhead(&Config{}, net.ParseIP("2001:db8::1")))
+	assert.Equal(t, 80, endpointOverhead(&Config{}, nil))
+	// GRE over the tunnel
+	assert.Equal(t, 104, endpointOverhead(&Config{MTUOverhead: IPv6Overhead + 24}, net.ParseIP("123.12.12.1")))
+}
+
+func TestRouteMTU(t *testing.T) {
+	link := &netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Index: 3}}
+	assert.Equal(t, 1400, routeMTU(netlink.Route{LinkIndex: 2, MTU: 1400}, link))
+	// routes through the wireguard link itself don't count
+	assert.Equal(t, 0, routeMTU(netlink.Route{LinkIndex: 3, MTU: 1400}, link))
+	assert.Equal(t, 0, routeMTU(netlink.Route{MTU: 1400}, link))
+}
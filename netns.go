@@ -0,0 +1,44 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"runtime"
+
+	"github.com/vishvananda/netns"
+)
+
+// inNamespace runs fn with the calling OS thread switched to cfg.Namespace. Network namespaces are per thread, so the goroutine is locked to it.
+// Hooks executed from fn inherit the namespace as well.
+func inNamespace(cfg *Config, fn func() error) error {
+	if cfg.Namespace == "" {
+		return fn()
+	}
+	runtime.LockOSThread()
+
+	orig, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer orig.Close()
+	target, err := netns.GetFromName(cfg.Namespace)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer target.Close()
+
+	if err := netns.Set(target); err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer func() {
+		// if the thread can't be switched back it stays locked, and it's terminated once the goroutine exits
+		if err := netns.Set(orig); err == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+	return fn()
+}
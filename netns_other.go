@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package wgquick
+
+import "fmt"
+
+// inNamespace runs fn, network namespaces only exist on linux
+func inNamespace(cfg *Config, fn func() error) error {
+	if cfg.Namespace != "" {
+		return fmt.Errorf("%w: network namespace %s", ErrNotSupported, cfg.Namespace)
+	}
+	return fn()
+}
@@ -0,0 +1,188 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// AddPeer adds the peer to the running interface and to cfg.Peers, and installs routes for its AllowedIPs. Other peers aren't touched.
+// On error cfg is left as it was, the device and routes may be partially updated.
+// When Table is auto and the peer has a default route, it falls back to full Sync since the firewall mark and policy rules may need to be set up.
+func AddPeer(cfg *Config, iface string, peer wgtypes.PeerConfig, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface).With(zap.String("peer", peer.PublicKey.String()))
+	if findPeer(cfg, peer.PublicKey) >= 0 {
+		return fmt.Errorf("peer %s already exists", peer.PublicKey)
+	}
+	peer.Remove = false
+	peer.UpdateOnly = false
+	peers := cfg.Peers
+	cfg.Peers = append(cfg.Peers[:len(peers):len(peers)], peer)
+	if err := applyPeer(cfg, iface, peer, nil, peer.AllowedIPs, log); err != nil {
+		cfg.Peers = peers
+		return err
+	}
+	return nil
+}
+
+// UpdatePeer replaces the settings of an existing peer on the running interface and in cfg.Peers, and adjusts routes for added/removed AllowedIPs.
+// As with AddPeer, cfg is left as it was on error.
+func UpdatePeer(cfg *Config, iface string, peer wgtypes.PeerConfig, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface).With(zap.String("peer", peer.PublicKey.String()))
+	idx := findPeer(cfg, peer.PublicKey)
+	if idx < 0 {
+		return fmt.Errorf("peer %s not found", peer.PublicKey)
+	}
+	peer.Remove = false
+	peer.UpdateOnly = true
+	peer.ReplaceAllowedIPs = true
+	old := cfg.Peers[idx]
+	cfg.Peers[idx] = peer
+	if err := applyPeer(cfg, iface, peer, diffIPNets(old.AllowedIPs, peer.AllowedIPs), diffIPNets(peer.AllowedIPs, old.AllowedIPs), log); err != nil {
+		cfg.Peers[idx] = old
+		return err
+	}
+	return nil
+}
+
+// RemovePeer removes the peer from the running interface and from cfg.Peers, and deletes routes for its AllowedIPs.
+// As with AddPeer, cfg is left as it was on error.
+func RemovePeer(cfg *Config, iface string, publicKey wgtypes.Key, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface).With(zap.String("peer", publicKey.String()))
+	idx := findPeer(cfg, publicKey)
+	if idx < 0 {
+		return fmt.Errorf("peer %s not found", publicKey)
+	}
+	peers := cfg.Peers
+	host, hasHost := cfg.EndpointHosts[publicKey]
+	comments, hasComments := cfg.PeerComments[publicKey]
+	name, hasName := cfg.PeerNames[publicKey]
+	cfg.Peers = append(cfg.Peers[:idx:idx], cfg.Peers[idx+1:]...)
+	delete(cfg.EndpointHosts, publicKey)
+	delete(cfg.PeerComments, publicKey)
+	delete(cfg.PeerNames, publicKey)
+	if err := applyPeer(cfg, iface, wgtypes.PeerConfig{PublicKey: publicKey, Remove: true}, peers[idx].AllowedIPs, nil, log); err != nil {
+		// the peer may still be on the device, keep it in cfg so it can be retried
+		cfg.Peers = peers
+		if hasHost {
+			cfg.EndpointHosts[publicKey] = host
+		}
+		if hasComments {
+			cfg.PeerComments[publicKey] = comments
+		}
+		if hasName {
+			cfg.PeerNames[publicKey] = name
+		}
+		return err
+	}
+	delete(cfg.PeerTables, publicKey)
+	return nil
+}
+
+func findPeer(cfg *Config, publicKey wgtypes.Key) int {
+	for i, peer := range cfg.Peers {
+		if peer.PublicKey == publicKey {
+			return i
+		}
+	}
+	return -1
+}
+
+// diffIPNets returns nets in a which aren't in b
+func diffIPNets(a, b []net.IPNet) []net.IPNet {
+	var diff []net.IPNet
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x.String() == y.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, x)
+		}
+	}
+	return diff
+}
+
+// applyPeer configures a single peer on the device and deletes/adds routes
+func applyPeer(cfg *Config, iface string, peer wgtypes.PeerConfig, delRoutes, addRoutes []net.IPNet, log *zap.Logger) error {
+	return inNamespace(cfg, func() error {
+		return applyPeerInNamespace(cfg, iface, peer, delRoutes, addRoutes, log)
+	})
+}
+
+func applyPeerInNamespace(cfg *Config, iface string, peer wgtypes.PeerConfig, delRoutes, addRoutes []net.IPNet, log *zap.Logger) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		log.Error("cannot read link", zap.Error(err))
+		return err
+	}
+
+	cl, err := wgctrl.New()
+	if err != nil {
+		log.Error("cannot setup wireguard device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	defer cl.Close()
+	if err := cfg.apply(log, "wg set peer", peer.PublicKey.String(), func() error {
+		return cl.ConfigureDevice(iface, wgtypes.Config{Peers: []wgtypes.PeerConfig{peer}})
+	}); err != nil {
+		log.Error("cannot configure peer", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	log.Info("configured peer", zap.Bool("removed", peer.Remove))
+
+	if table, ok := cfg.PeerTables[peer.PublicKey]; ok {
+		tableCfg := *cfg
+		tableCfg.Table = table
+		cfg = &tableCfg
+	}
+	if cfg.Table == TableOff {
+		return nil
+	}
+	if cfg.Table == TableAuto {
+		delDefaults, _ := splitDefaultRoutes(delRoutes)
+		addDefaults, _ := splitDefaultRoutes(addRoutes)
+		if len(delDefaults) > 0 || len(addDefaults) > 0 {
+			log.Info("default routes changed, syncing whole interface")
+			return syncInterface(cfg, iface, SyncWireguardDevice, log)
+		}
+	}
+
+	delRoutes = excludeRoutes(cfg, delRoutes)
+	addRoutes = excludeRoutes(cfg, addRoutes)
+	for _, dst := range delRoutes {
+		rt := managedRoute(cfg, link, dst)
+		if err := cfg.apply(log, "route del", rt.String(), func() error {
+			return netlink.RouteDel(&rt)
+		}); err != nil && err != syscall.ESRCH {
+			log.Error("cannot delete route", zap.String("route", dst.String()), zap.Error(err))
+			return stepError(ErrRouteSync, err)
+		}
+		log.Info("route deleted", zap.String("route", dst.String()))
+	}
+	for _, dst := range addRoutes {
+		rt := managedRoute(cfg, link, dst)
+		if err := cfg.apply(log, "route replace", rt.String(), func() error {
+			return netlink.RouteReplace(&rt)
+		}); err != nil {
+			log.Error("cannot add/replace route", zap.String("route", dst.String()), zap.Error(err))
+			return stepError(ErrRouteSync, err)
+		}
+		log.Info("route added/replaced", zap.String("route", dst.String()))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestDiffIPNets(t *testing.T) {
+	parse := func(cidrs ...string) []net.IPNet {
+		var nets []net.IPNet
+		for _, c := range cidrs {
+			_, n, err := net.ParseCIDR(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nets = append(nets, *n)
+		}
+		return nets
+	}
+	old := parse("10.0.0.0/24", "10.0.1.0/24", "fd00::/64")
+	updated := parse("10.0.1.0/24", "10.0.2.0/24")
+	assert.Equal(t, parse("10.0.0.0/24", "fd00::/64"), diffIPNets(old, updated))
+	assert.Equal(t, parse("10.0.2.0/24"), diffIPNets(updated, old))
+	assert.Nil(t, diffIPNets(old, old))
+}
+
+func TestPeerChangesKeepConfigOnError(t *testing.T) {
+	key, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	other, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	_, allowed, _ := net.ParseCIDR("10.0.0.2/32")
+	peer := wgtypes.PeerConfig{PublicKey: key.PublicKey(), AllowedIPs: []net.IPNet{*allowed}}
+	cfg := &Config{
+		Config:        wgtypes.Config{Peers: []wgtypes.PeerConfig{peer}},
+		EndpointHosts: map[wgtypes.Key]string{peer.PublicKey: "vpn.example.com:51820"},
+		PeerComments:  map[wgtypes.Key][]string{peer.PublicKey: {"laptop"}},
+		PeerNames:     map[wgtypes.Key]string{peer.PublicKey: "laptop"},
+	}
+	want := cfg.Clone()
+
+	// the link doesn't exist, every change fails
+	const iface = "wgquicktest-missing"
+	assert.Error(t, AddPeer(cfg, iface, wgtypes.PeerConfig{PublicKey: other.PublicKey()}, zap.NewNop()))
+	assert.Equal(t, want, cfg)
+	assert.Error(t, UpdatePeer(cfg, iface, wgtypes.PeerConfig{PublicKey: peer.PublicKey}, zap.NewNop()))
+	assert.Equal(t, want, cfg)
+	assert.Error(t, RemovePeer(cfg, iface, peer.PublicKey, zap.NewNop()))
+	assert.Equal(t, want, cfg)
+}
@@ -0,0 +1,121 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"os"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Reload applies config changes to a running interface without dropping the tunnel. The live wireguard device is diffed against cfg,
+// see Diff and DiffPeers, and only the deltas are configured: new and removed peers, and the changed settings of existing ones, so unchanged peers keep their handshakes.
+// Addresses, routes and rules are synced incrementally as in Sync. ReplacePeers is ignored. The interface must already exist, otherwise os.ErrNotExist is returned
+func Reload(cfg *Config, iface string, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	return inNamespace(cfg, func() error {
+		exists, err := InterfaceExists(iface)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			ifaceLogger(logger, iface).Error("link not found, cannot reload")
+			return stepError(ErrLinkSync, os.ErrNotExist)
+		}
+		return syncInterface(cfg, iface, reloadWireguardDevice, logger)
+	})
+}
+
+// reloadWireguardDevice configures only what differs between the config and the device
+func reloadWireguardDevice(cfg *Config, link netlink.Link, log *zap.Logger) error {
+	cl, err := wgctrl.New()
+	if err != nil {
+		log.Error("cannot setup wireguard device", zap.Error(err))
+		return err
+	}
+	defer cl.Close()
+
+	dev, err := cl.Device(link.Attrs().Name)
+	if err != nil {
+		log.Error("cannot read wireguard device", zap.Error(err))
+		return err
+	}
+	wgCfg := reloadConfig(cfg, dev)
+	if wgCfg.PrivateKey == nil && wgCfg.ListenPort == nil && wgCfg.FirewallMark == nil && len(wgCfg.Peers) == 0 {
+		log.Info("wireguard device unchanged")
+		return nil
+	}
+	if err := cfg.apply(log, "wg set", link.Attrs().Name, func() error {
+		return cl.ConfigureDevice(link.Attrs().Name, wgCfg)
+	}); err != nil {
+		log.Error("cannot configure device", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// reloadConfig is the wireguard config turning dev into cfg, touching only what differs
+func reloadConfig(cfg *Config, dev *wgtypes.Device) wgtypes.Config {
+	diff := diffDevice(cfg, dev, nil, nil)
+	var wgCfg wgtypes.Config
+	if diff.PrivateKey {
+		wgCfg.PrivateKey = cfg.PrivateKey
+	}
+	if diff.ListenPort {
+		wgCfg.ListenPort = cfg.ListenPort
+	}
+	if diff.FirewallMark {
+		wgCfg.FirewallMark = cfg.FirewallMark
+	}
+
+	changed := diffPeers(cfg, dev)
+	present := make(map[wgtypes.Key]bool, len(dev.Peers))
+	for _, p := range dev.Peers {
+		present[p.PublicKey] = true
+	}
+	for _, peer := range cfg.Peers {
+		if !present[peer.PublicKey] {
+			wgCfg.Peers = append(wgCfg.Peers, peer)
+			continue
+		}
+		if d, ok := changed[peer.PublicKey]; ok {
+			wgCfg.Peers = append(wgCfg.Peers, reloadPeer(peer, d))
+		}
+	}
+	wgCfg.Peers = append(wgCfg.Peers, stalePeers(cfg, dev)...)
+	return wgCfg
+}
+
+// reloadPeer updates an existing peer with the differences in d. AllowedIPs are only replaced if some have to go, otherwise the new ones are added
+func reloadPeer(peer wgtypes.PeerConfig, d *PeerDiff) wgtypes.PeerConfig {
+	update := wgtypes.PeerConfig{PublicKey: peer.PublicKey, UpdateOnly: true}
+	if d.Endpoint {
+		update.Endpoint = peer.Endpoint
+	}
+	if d.PresharedKey {
+		update.PresharedKey = peer.PresharedKey
+		if update.PresharedKey == nil {
+			update.PresharedKey = &wgtypes.Key{}
+		}
+	}
+	if d.PersistentKeepalive {
+		update.PersistentKeepaliveInterval = peer.PersistentKeepaliveInterval
+		if update.PersistentKeepaliveInterval == nil {
+			var off time.Duration
+			update.PersistentKeepaliveInterval = &off
+		}
+	}
+	switch {
+	case len(d.DelAllowedIPs) > 0:
+		update.ReplaceAllowedIPs = true
+		update.AllowedIPs = peer.AllowedIPs
+	case len(d.AddAllowedIPs) > 0:
+		update.AllowedIPs = d.AddAllowedIPs
+	}
+	return update
+}
@@ -0,0 +1,50 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestReloadConfig(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(testConfigs["sample-2"])))
+
+	var peers []wgtypes.Peer
+	for _, peer := range cfg.Peers {
+		peers = append(peers, wgtypes.Peer{PublicKey: peer.PublicKey, AllowedIPs: maskedIPNets(peer.AllowedIPs)})
+	}
+	dev := &wgtypes.Device{
+		PrivateKey: *cfg.PrivateKey,
+		ListenPort: *cfg.ListenPort,
+		Peers:      peers,
+	}
+	assert.Equal(t, wgtypes.Config{}, reloadConfig(cfg, dev), "nothing changed")
+
+	stale, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	_, extra, err := net.ParseCIDR("10.20.0.0/24")
+	assert.NoError(t, err)
+	dev.Peers = []wgtypes.Peer{
+		{PublicKey: peers[0].PublicKey, AllowedIPs: peers[0].AllowedIPs[1:]},
+		{PublicKey: peers[1].PublicKey, AllowedIPs: append(append([]net.IPNet(nil), peers[1].AllowedIPs...), *extra)},
+		{PublicKey: stale},
+	}
+	dev.ListenPort = 1234
+
+	wgCfg := reloadConfig(cfg, dev)
+	assert.Equal(t, cfg.ListenPort, wgCfg.ListenPort)
+	assert.Nil(t, wgCfg.PrivateKey)
+	assert.False(t, wgCfg.ReplacePeers)
+	assert.Equal(t, []wgtypes.PeerConfig{
+		{PublicKey: peers[0].PublicKey, UpdateOnly: true, AllowedIPs: peers[0].AllowedIPs[:1]},
+		{PublicKey: peers[1].PublicKey, UpdateOnly: true, ReplaceAllowedIPs: true, AllowedIPs: cfg.Peers[1].AllowedIPs},
+		cfg.Peers[2],
+		{PublicKey: stale, Remove: true},
+	}, wgCfg.Peers)
+}
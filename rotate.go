@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// RotateKey replaces the private key of the running interface and of cfg, and returns the new public key for the operator to hand out to the peers.
+// Only the key is changed, peers and routes aren't touched. Peers need the new public key before they can complete the next handshake.
+// With PrivateKeyFile set, the new key is then written to that file, so a later Up or Sync doesn't bring the old key back.
+// If that write fails, the device is set back to the old key from cfg
+func RotateKey(cfg *Config, iface string, privateKey wgtypes.Key, logger *zap.Logger) (wgtypes.Key, error) {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface)
+
+	if err := setPrivateKey(cfg, iface, privateKey, log); err != nil {
+		log.Error("cannot set private key", zap.Error(err))
+		return wgtypes.Key{}, stepError(ErrDeviceSync, err)
+	}
+
+	if cfg.PrivateKeyFile != "" {
+		if err := cfg.apply(log, "file write", cfg.PrivateKeyFile, func() error {
+			return writeFileAtomic(cfg.PrivateKeyFile, []byte(privateKey.String()+"\n"))
+		}); err != nil {
+			log.Error("cannot write private key file", zap.Error(err))
+			if cfg.PrivateKey != nil {
+				if rerr := setPrivateKey(cfg, iface, *cfg.PrivateKey, log); rerr != nil {
+					log.Error("cannot restore old private key", zap.Error(rerr))
+				}
+			}
+			return wgtypes.Key{}, err
+		}
+	}
+
+	cfg.PrivateKey = &privateKey
+	publicKey := privateKey.PublicKey()
+	log.Info("rotated private key", zap.String("public_key", publicKey.String()))
+	return publicKey, nil
+}
+
+// setPrivateKey sets only the private key of the device
+func setPrivateKey(cfg *Config, iface string, privateKey wgtypes.Key, log *zap.Logger) error {
+	return inNamespace(cfg, func() error {
+		return cfg.apply(log, "wg set private-key", iface, func() error {
+			cl, err := wgctrl.New()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+			return cl.ConfigureDevice(iface, wgtypes.Config{PrivateKey: &privateKey})
+		})
+	})
+}
@@ -0,0 +1,79 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestRotateKeyDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-rotate")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	old, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	key, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	actions := []Action{}
+	cfg := &Config{PrivateKeyFile: filepath.Join(dir, "wg0.key"), plan: &actions}
+	cfg.PrivateKey = &old
+
+	pub, err := RotateKey(cfg, "wg0", key, zap.NewNop())
+	assert.NoError(t, err)
+	assert.Equal(t, key.PublicKey(), pub)
+	assert.Equal(t, key, *cfg.PrivateKey)
+	assert.Equal(t, []Action{
+		{Op: "wg set private-key", Args: "wg0"},
+		{Op: "file write", Args: cfg.PrivateKeyFile},
+	}, actions)
+	_, err = os.Stat(cfg.PrivateKeyFile)
+	assert.True(t, os.IsNotExist(err), "dry run doesn't write the key")
+}
+
+func TestRotateKeyMissingDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-rotate")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	old, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	key, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	cfg := &Config{PrivateKeyFile: filepath.Join(dir, "wg0.key")}
+	cfg.PrivateKey = &old
+
+	pub, err := RotateKey(cfg, "wgquicktest-missing", key, zap.NewNop())
+	assert.Error(t, err)
+	assert.Equal(t, wgtypes.Key{}, pub)
+	assert.Equal(t, old, *cfg.PrivateKey)
+	_, err = os.Stat(cfg.PrivateKeyFile)
+	assert.True(t, os.IsNotExist(err), "key isn't written when the device cannot be set")
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-rotate")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	cfg := &Config{PrivateKeyFile: filepath.Join(dir, "wg0.key")}
+	assert.NoError(t, writeFileAtomic(cfg.PrivateKeyFile, []byte(key.String()+"\n")))
+	assert.NoError(t, cfg.loadPrivateKeyFile())
+	assert.Equal(t, key, *cfg.PrivateKey)
+}
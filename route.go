@@ -0,0 +1,164 @@
+package wgquick
+
+import "net"
+
+// Route is a kernel route installed together with the interface, on top of routes for peers' AllowedIPs.
+// AllowedIPs decide which peer a packet goes to (crypto-key routing), Routes are for kernel routing needs AllowedIPs can't express.
+type Route struct {
+	Dst net.IPNet
+	// Gw is an optional gateway reachable through the interface
+	Gw net.IP
+	// Blackhole drops matching packets instead of routing them through the interface. Gw is ignored
+	Blackhole bool
+	// Table overrides the config's Table for this route, 0 uses it (main table for TableAuto and TableOff)
+	Table int
+	// Metric overrides the config's RouteMetric for this route, 0 uses it
+	Metric int
+}
+
+func isDefaultRoute(rt net.IPNet) bool {
+	ones, _ := rt.Mask.Size()
+	return ones == 0
+}
+
+// splitDefaultRoutes separates default routes (0.0.0.0/0 and ::/0) from the rest of managed routes
+func splitDefaultRoutes(managedRoutes []net.IPNet) (defaults []net.IPNet, rest []net.IPNet) {
+	for _, rt := range managedRoutes {
+		if isDefaultRoute(rt) {
+			defaults = append(defaults, rt)
+		} else {
+			rest = append(rest, rt)
+		}
+	}
+	return defaults, rest
+}
+
+// allowedIPs returns AllowedIPs of all peers
+func allowedIPs(cfg *Config) []net.IPNet {
+	var ips []net.IPNet
+	for _, peer := range cfg.Peers {
+		ips = append(ips, peer.AllowedIPs...)
+	}
+	return ips
+}
+
+// maskedIPNets zeroes host bits, the same as the kernel does for routes and AllowedIPs
+func maskedIPNets(nets []net.IPNet) []net.IPNet {
+	masked := make([]net.IPNet, 0, len(nets))
+	for _, n := range nets {
+		masked = append(masked, net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask})
+	}
+	return masked
+}
+
+// peerRoutes returns routes for AllowedIPs of all peers. Prefixes covered by another prefix of the same peer are left out, they'd only be redundant routes.
+// Prefixes of different peers are never aggregated, so each route stays exact for its peer.
+// When Table is auto default routes go to a table of their own, so they don't cover anything in the main table
+// Peers with a table in PeerTables are left out, see peerTableRoutes
+func peerRoutes(cfg *Config) []net.IPNet {
+	var routes []net.IPNet
+	for _, peer := range cfg.Peers {
+		if _, ok := cfg.PeerTables[peer.PublicKey]; ok {
+			continue
+		}
+		for i, rt := range peer.AllowedIPs {
+			if !coveredRoute(cfg, peer.AllowedIPs, i) {
+				routes = append(routes, rt)
+			}
+		}
+	}
+	return excludeRoutes(cfg, routes)
+}
+
+// peerTableRoutes returns routes of peers with a table in PeerTables, by table
+func peerTableRoutes(cfg *Config) map[int][]net.IPNet {
+	routes := make(map[int][]net.IPNet)
+	for _, peer := range cfg.Peers {
+		table, ok := cfg.PeerTables[peer.PublicKey]
+		if !ok {
+			continue
+		}
+		tableCfg := *cfg
+		tableCfg.Table = table
+		for i, rt := range peer.AllowedIPs {
+			if !coveredRoute(&tableCfg, peer.AllowedIPs, i) {
+				routes[table] = append(routes[table], excludeRoutes(&tableCfg, []net.IPNet{rt})...)
+			}
+		}
+	}
+	return routes
+}
+
+// excludeRoutes subtracts ExcludedRoutes from routes, routes containing an excluded prefix are split into the prefixes around it.
+// With Table = auto default routes are kept, the policy rules already prefer the main table's subnets over them
+func excludeRoutes(cfg *Config, routes []net.IPNet) []net.IPNet {
+	if len(cfg.ExcludedRoutes) == 0 {
+		return routes
+	}
+	var out []net.IPNet
+	for _, rt := range routes {
+		if cfg.Table == TableAuto && isDefaultRoute(rt) {
+			out = append(out, rt)
+			continue
+		}
+		rest := []net.IPNet{rt}
+		for _, ex := range cfg.ExcludedRoutes {
+			var next []net.IPNet
+			for _, r := range rest {
+				next = append(next, subtractPrefix(r, ex)...)
+			}
+			rest = next
+		}
+		out = append(out, rest...)
+	}
+	return out
+}
+
+// subtractPrefix returns the prefixes covering rt except ex
+func subtractPrefix(rt, ex net.IPNet) []net.IPNet {
+	ones, bits := rt.Mask.Size()
+	exOnes, exBits := ex.Mask.Size()
+	switch {
+	case bits != exBits:
+		return []net.IPNet{rt}
+	case exOnes <= ones && ex.Contains(rt.IP):
+		return nil
+	case exOnes <= ones || !rt.Contains(ex.IP):
+		return []net.IPNet{rt}
+	}
+	// halve rt until reaching ex, keeping the halves without it
+	var out []net.IPNet
+	cur := rt.IP.Mask(rt.Mask)
+	for ; ones < exOnes; ones++ {
+		mask := net.CIDRMask(ones+1, bits)
+		lo := net.IPNet{IP: cur, Mask: mask}
+		hiIP := append(net.IP{}, cur...)
+		hiIP[ones/8] |= 0x80 >> uint(ones%8)
+		hi := net.IPNet{IP: hiIP, Mask: mask}
+		if hi.Contains(ex.IP) {
+			out = append(out, lo)
+			cur = hiIP
+		} else {
+			out = append(out, hi)
+		}
+	}
+	return out
+}
+
+// coveredRoute reports whether nets[i] is within a shorter prefix among nets. Of equal prefixes only the first one isn't covered
+func coveredRoute(cfg *Config, nets []net.IPNet, i int) bool {
+	ones, bits := nets[i].Mask.Size()
+	for j, other := range nets {
+		otherOnes, otherBits := other.Mask.Size()
+		if j == i || otherBits != bits || !other.Contains(nets[i].IP) {
+			continue
+		}
+		if cfg.Table == TableAuto && otherOnes == 0 {
+			continue
+		}
+		if otherOnes < ones || (otherOnes == ones && j < i) {
+			return true
+		}
+	}
+	return false
+}
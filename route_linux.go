@@ -0,0 +1,83 @@
+package wgquick
+
+import (
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// netlinkRoute returns the route as installed for link
+func (r *Route) netlinkRoute(cfg *Config, link netlink.Link) netlink.Route {
+	dst := r.Dst
+	rt := netlink.Route{
+		Dst:      &dst,
+		Table:    r.Table,
+		Protocol: cfg.RouteProtocol,
+		Priority: r.Metric,
+	}
+	if rt.Table == 0 && cfg.Table > 0 {
+		rt.Table = cfg.Table
+	}
+	if rt.Priority == 0 {
+		rt.Priority = cfg.RouteMetric
+	}
+	if r.Blackhole {
+		rt.Type = unix.RTN_BLACKHOLE
+	} else {
+		rt.LinkIndex = link.Attrs().Index
+		rt.Gw = r.Gw
+	}
+	fillRouteDefaults(&rt)
+	return rt
+}
+
+// extraRoutes returns cfg.Routes as installed for link
+func extraRoutes(cfg *Config, link netlink.Link) []netlink.Route {
+	routes := make([]netlink.Route, 0, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		routes = append(routes, r.netlinkRoute(cfg, link))
+	}
+	return routes
+}
+
+// syncExtraRoutes adds or replaces cfg.Routes. They're installed even when Table is off, since they're listed explicitly
+func syncExtraRoutes(cfg *Config, link netlink.Link, logger *zap.Logger) error {
+	for _, rt := range extraRoutes(cfg, link) {
+		rt := rt // make copy
+		log := logger.With(
+			zap.String("route", rt.Dst.String()),
+			zap.Int("table", rt.Table),
+			zap.Int("type", rt.Type),
+			zap.Int("metric", rt.Priority),
+		)
+		if err := cfg.apply(log, "route replace", rt.String(), func() error {
+			return netlink.RouteReplace(&rt)
+		}); err != nil {
+			log.Error("cannot add/replace route", zap.Error(err))
+			return err
+		}
+		log.Info("route added/replaced")
+	}
+	return nil
+}
+
+// deleteExtraRoutes deletes blackhole routes from cfg.Routes. The rest go through the link and are removed together with it
+func deleteExtraRoutes(cfg *Config, link netlink.Link, logger *zap.Logger) error {
+	for _, rt := range extraRoutes(cfg, link) {
+		if rt.Type != unix.RTN_BLACKHOLE {
+			continue
+		}
+		rt := rt // make copy
+		log := logger.With(zap.String("route", rt.Dst.String()), zap.Int("table", rt.Table))
+		if err := cfg.apply(log, "route del", rt.String(), func() error {
+			return netlink.RouteDel(&rt)
+		}); err != nil && err != syscall.ESRCH {
+			log.Error("cannot delete route", zap.Error(err))
+			return err
+		}
+		log.Info("route deleted")
+	}
+	return nil
+}
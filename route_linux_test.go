@@ -0,0 +1,64 @@
+package wgquick
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestRouteNetlinkRoute(t *testing.T) {
+	link := &netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Index: 7}}
+	_, dst, _ := net.ParseCIDR("10.1.0.0/16")
+	cfg := &Config{Table: 1234, RouteMetric: 10, RouteProtocol: 42}
+
+	r := Route{Dst: *dst, Gw: net.ParseIP("10.0.0.1")}
+	rt := r.netlinkRoute(cfg, link)
+	assert.Equal(t, 7, rt.LinkIndex)
+	assert.Equal(t, "10.0.0.1", rt.Gw.String())
+	assert.Equal(t, 1234, rt.Table)
+	assert.Equal(t, 10, rt.Priority)
+	assert.Equal(t, 42, rt.Protocol)
+	assert.Equal(t, unix.RTN_UNICAST, rt.Type)
+
+	r = Route{Dst: *dst, Blackhole: true, Table: 100, Metric: 5}
+	rt = r.netlinkRoute(&Config{Table: TableOff}, link)
+	assert.Equal(t, 0, rt.LinkIndex)
+	assert.Equal(t, unix.RTN_BLACKHOLE, rt.Type)
+	assert.Equal(t, 100, rt.Table)
+	assert.Equal(t, 5, rt.Priority)
+
+	r = Route{Dst: *dst}
+	rt = r.netlinkRoute(&Config{Table: TableOff}, link)
+	assert.Equal(t, unix.RT_TABLE_MAIN, rt.Table)
+	assert.Equal(t, DefaultRouteProtocol, rt.Protocol)
+}
+
+func TestRoutesJSON(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	_, dst, _ := net.ParseCIDR("192.168.0.0/16")
+	_, blackhole, _ := net.ParseCIDR("fd00::/8")
+	c.Routes = []Route{
+		{Dst: *dst, Gw: net.ParseIP("10.200.100.1"), Metric: 50},
+		{Dst: *blackhole, Blackhole: true},
+	}
+	assert.NoError(t, c.Validate())
+
+	b, err := json.Marshal(c)
+	assert.NoError(t, err)
+	c2 := &Config{}
+	assert.NoError(t, json.Unmarshal(b, c2))
+	if assert.Len(t, c2.Routes, 2) {
+		assert.Equal(t, "192.168.0.0/16", c2.Routes[0].Dst.String())
+		assert.Equal(t, "10.200.100.1", c2.Routes[0].Gw.String())
+		assert.Equal(t, 50, c2.Routes[0].Metric)
+		assert.True(t, c2.Routes[1].Blackhole)
+	}
+
+	c.Routes[0].Gw = net.ParseIP("fd00::1")
+	assert.Error(t, c.Validate())
+}
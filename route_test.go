@@ -0,0 +1,116 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestPeerRoutes(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(`[Interface]
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.1.0.0/16, 10.0.0.0/8, 10.0.0.1/8, fd00::/64, fd00::/8, 0.0.0.0/0
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.2.0.0/16
+`)))
+	var routes []string
+	for _, rt := range peerRoutes(cfg) {
+		routes = append(routes, rt.String())
+	}
+	// default route goes to its own table, it doesn't cover the rest; other peer's routes aren't aggregated
+	assert.Equal(t, []string{"10.0.0.0/8", "fd00::/8", "0.0.0.0/0", "10.2.0.0/16"}, routes)
+
+	cfg.Table = 1234
+	routes = nil
+	for _, rt := range peerRoutes(cfg) {
+		routes = append(routes, rt.String())
+	}
+	assert.Equal(t, []string{"fd00::/8", "0.0.0.0/0", "10.2.0.0/16"}, routes)
+}
+
+func TestPeerTableRoutes(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(`[Interface]
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.1.0.0/16, 10.0.0.0/8, 0.0.0.0/0
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.2.0.0/16
+`)))
+	cfg.PeerTables = map[wgtypes.Key]int{cfg.Peers[0].PublicKey: 100}
+
+	var routes []string
+	for _, rt := range peerRoutes(cfg) {
+		routes = append(routes, rt.String())
+	}
+	assert.Equal(t, []string{"10.2.0.0/16"}, routes)
+
+	tables := peerTableRoutes(cfg)
+	assert.Len(t, tables, 1)
+	routes = nil
+	for _, rt := range tables[100] {
+		routes = append(routes, rt.String())
+	}
+	// the peer's table isn't auto, so the default route covers the rest
+	assert.Equal(t, []string{"0.0.0.0/0"}, routes)
+}
+
+func TestSplitDefaultRoutes(t *testing.T) {
+	var routes []net.IPNet
+	for _, cidr := range []string{"0.0.0.0/0", "10.0.0.0/8", "::/0", "0.0.0.0/1"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes = append(routes, *n)
+	}
+	// with Table = auto, default routes go to the fwmark table, the host's default route in main is left alone
+	defaults, rest := splitDefaultRoutes(routes)
+	assert.Equal(t, []net.IPNet{routes[0], routes[2]}, defaults)
+	assert.Equal(t, []net.IPNet{routes[1], routes[3]}, rest)
+}
+
+func TestExcludeRoutes(t *testing.T) {
+	parse := func(cidrs ...string) []net.IPNet {
+		var nets []net.IPNet
+		for _, cidr := range cidrs {
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nets = append(nets, *n)
+		}
+		return nets
+	}
+	str := func(nets []net.IPNet) []string {
+		var s []string
+		for _, n := range nets {
+			s = append(s, n.String())
+		}
+		return s
+	}
+
+	cfg := &Config{ExcludedRoutes: parse("192.168.1.0/24", "10.1.0.0/16")}
+	assert.Equal(t, []string{
+		"0.0.0.0/0",
+		"10.128.0.0/9", "10.64.0.0/10", "10.32.0.0/11", "10.16.0.0/12", "10.8.0.0/13", "10.4.0.0/14", "10.2.0.0/15", "10.0.0.0/16",
+		"fd00::/8",
+	}, str(excludeRoutes(cfg, parse("0.0.0.0/0", "10.0.0.0/8", "10.1.2.0/24", "fd00::/8"))))
+
+	// only default routes with Table = auto are kept whole
+	cfg.Table = 1234
+	cfg.ExcludedRoutes = parse("128.0.0.0/2")
+	assert.Equal(t, []string{"0.0.0.0/1", "192.0.0.0/2"}, str(excludeRoutes(cfg, parse("0.0.0.0/0"))))
+}
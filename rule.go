@@ -0,0 +1,24 @@
+package wgquick
+
+import "net"
+
+// Rule is a policy routing rule (as in `ip rule`) installed on Up and removed on Down, so selective routing doesn't need PostUp scripts.
+// Packets matching all the set selectors are routed using Table.
+type Rule struct {
+	// Src and Dst match source and destination prefixes, nil matches all
+	Src *net.IPNet
+	Dst *net.IPNet
+	// Mark matches the firewall mark, 0 matches all
+	Mark int
+	// Table is the routing table to look up
+	Table int
+	// Priority of the rule, lower is evaluated first. 0 lets the kernel pick one
+	Priority int
+}
+
+func ipNetString(n *net.IPNet) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
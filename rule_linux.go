@@ -0,0 +1,107 @@
+package wgquick
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// netlinkRules returns the rule for each family it applies to. Rules without prefixes apply to both IPv4 and IPv6
+func (r *Rule) netlinkRules() []*netlink.Rule {
+	families := []int{netlink.FAMILY_V4, netlink.FAMILY_V6}
+	switch {
+	case r.Src != nil:
+		families = []int{routeFamily(*r.Src)}
+	case r.Dst != nil:
+		families = []int{routeFamily(*r.Dst)}
+	}
+	rules := make([]*netlink.Rule, 0, len(families))
+	for _, family := range families {
+		rule := netlink.NewRule()
+		rule.Family = family
+		rule.Src = r.Src
+		rule.Dst = r.Dst
+		rule.Table = r.Table
+		if r.Mark != 0 {
+			rule.Mark = r.Mark
+		}
+		if r.Priority != 0 {
+			rule.Priority = r.Priority
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// findRule returns the rule among present matching rule, a rule without priority matches any priority
+func findRule(present []netlink.Rule, rule *netlink.Rule) *netlink.Rule {
+	for i, r := range present {
+		if rule.Priority >= 0 && r.Priority != rule.Priority {
+			continue
+		}
+		if r.Table == rule.Table && r.Mark == rule.Mark && ipNetString(r.Src) == ipNetString(rule.Src) && ipNetString(r.Dst) == ipNetString(rule.Dst) {
+			return &present[i]
+		}
+	}
+	return nil
+}
+
+// syncRules adds cfg.Rules which aren't present yet
+func syncRules(cfg *Config, logger *zap.Logger) error {
+	for _, r := range cfg.Rules {
+		for _, rule := range r.netlinkRules() {
+			log := logger.With(zap.String("rule", configRuleString(rule)))
+			present, err := netlink.RuleList(rule.Family)
+			if err != nil {
+				log.Error("cannot read existing rules", zap.Error(err))
+				return err
+			}
+			if findRule(present, rule) != nil {
+				log.Debug("rule present")
+				continue
+			}
+			if err := cfg.apply(log, "rule add", configRuleString(rule), func() error {
+				return netlink.RuleAdd(rule)
+			}); err != nil && err != syscall.EEXIST {
+				log.Error("cannot add rule", zap.Error(err))
+				return err
+			}
+			log.Info("rule added")
+		}
+	}
+	return nil
+}
+
+// deleteRules removes cfg.Rules
+func deleteRules(cfg *Config, logger *zap.Logger) error {
+	for _, r := range cfg.Rules {
+		for _, rule := range r.netlinkRules() {
+			log := logger.With(zap.String("rule", configRuleString(rule)))
+			present, err := netlink.RuleList(rule.Family)
+			if err != nil {
+				log.Error("cannot read existing rules", zap.Error(err))
+				return err
+			}
+			found := findRule(present, rule)
+			if found == nil {
+				continue
+			}
+			// delete exactly the rule found, the kernel may have picked the priority
+			rule.Priority = found.Priority
+			if err := cfg.apply(log, "rule del", configRuleString(rule), func() error {
+				return netlink.RuleDel(rule)
+			}); err != nil {
+				log.Error("cannot delete rule", zap.Error(err))
+				return err
+			}
+			log.Info("rule deleted")
+		}
+	}
+	return nil
+}
+
+func configRuleString(rule *netlink.Rule) string {
+	return fmt.Sprintf("%s from %s to %s", ruleString(rule), ipNetString(rule.Src), ipNetString(rule.Dst))
+}
@@ -0,0 +1,78 @@
+package wgquick
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestRuleNetlinkRules(t *testing.T) {
+	_, src, _ := net.ParseCIDR("fd00::/64")
+	rules := (&Rule{Src: src, Table: 100}).netlinkRules()
+	if assert.Len(t, rules, 1) {
+		assert.Equal(t, netlink.FAMILY_V6, rules[0].Family)
+		assert.Equal(t, 100, rules[0].Table)
+		assert.Equal(t, -1, rules[0].Priority)
+		assert.Equal(t, -1, rules[0].Mark)
+	}
+
+	rules = (&Rule{Mark: 0x10, Table: 100, Priority: 1000}).netlinkRules()
+	if assert.Len(t, rules, 2) {
+		assert.Equal(t, netlink.FAMILY_V4, rules[0].Family)
+		assert.Equal(t, netlink.FAMILY_V6, rules[1].Family)
+		assert.Equal(t, 0x10, rules[1].Mark)
+		assert.Equal(t, 1000, rules[1].Priority)
+	}
+}
+
+func TestFindRule(t *testing.T) {
+	_, src, _ := net.ParseCIDR("10.0.0.0/24")
+	_, other, _ := net.ParseCIDR("10.0.1.0/24")
+	present := []netlink.Rule{
+		{Priority: 0, Table: 255, Mark: -1},
+		{Priority: 100, Table: 100, Mark: -1, Src: other},
+		{Priority: 200, Table: 100, Mark: -1, Src: src},
+	}
+
+	rule := (&Rule{Src: src, Table: 100}).netlinkRules()[0]
+	if found := findRule(present, rule); assert.NotNil(t, found) {
+		assert.Equal(t, 200, found.Priority)
+	}
+	rule = (&Rule{Src: src, Table: 100, Priority: 100}).netlinkRules()[0]
+	assert.Nil(t, findRule(present, rule))
+}
+
+func TestRulesJSON(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	_, src, _ := net.ParseCIDR("10.200.100.0/24")
+	c.Rules = []Rule{
+		{Src: src, Table: 100, Priority: 1000},
+		{Mark: 0x10, Table: 200},
+	}
+	assert.NoError(t, c.Validate())
+
+	b, err := json.Marshal(c)
+	assert.NoError(t, err)
+	c2 := &Config{}
+	assert.NoError(t, json.Unmarshal(b, c2))
+	assert.Equal(t, c.Rules, c2.Rules)
+
+	c.Rules = append(c.Rules, Rule{Src: src})
+	assert.Error(t, c.Validate())
+}
+
+func TestAutoTableRulesPriority(t *testing.T) {
+	rules := autoTableRules(&Config{}, 51820, netlink.FAMILY_V4)
+	if assert.Len(t, rules, 3) {
+		assert.Equal(t, []int{32000, 32001, 32002}, []int{rules[0].Priority, rules[1].Priority, rules[2].Priority})
+		assert.Equal(t, 51820, rules[1].Mark)
+		assert.Equal(t, 51820, rules[2].Table)
+	}
+
+	rules = autoTableRules(&Config{RulePriority: 31000}, 51821, netlink.FAMILY_V6)
+	assert.Equal(t, []int{31000, 31001, 31002}, []int{rules[0].Priority, rules[1].Priority, rules[2].Priority})
+}
@@ -0,0 +1,22 @@
+package wgquick
+
+import "context"
+
+// CommandRunner runs the shell commands of hooks and DNS configuration, see Config.Runner.
+// Tests can record commands with a fake, security conscious users can wrap ShellRunner to audit or restrict what runs
+type CommandRunner interface {
+	// Run runs a single command line with the system shell (`sh -ce` on Unix, `cmd.exe /C` on Windows), feeding it stdin, and returns the combined output
+	Run(ctx context.Context, command string, stdin string) ([]byte, error)
+}
+
+// ShellRunner is the CommandRunner used when Config.Runner isn't set
+type ShellRunner struct{}
+
+var _ CommandRunner = ShellRunner{}
+
+func (cfg *Config) runner() CommandRunner {
+	if cfg.Runner != nil {
+		return cfg.Runner
+	}
+	return ShellRunner{}
+}
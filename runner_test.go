@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package wgquick
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeRunner struct {
+	commands []string
+	stdin    []string
+	err      error
+}
+
+func (r *fakeRunner) Run(ctx context.Context, command string, stdin string) ([]byte, error) {
+	r.commands = append(r.commands, command)
+	r.stdin = append(r.stdin, stdin)
+	return nil, r.err
+}
+
+func TestRunner(t *testing.T) {
+	r := &fakeRunner{}
+	cfg := &Config{Runner: r}
+	assert.NoError(t, execSh(context.Background(), cfg, "ip link show %i\necho up", "wg0", zap.NewNop(), "nameserver 10.0.0.1\n"))
+	assert.Equal(t, []string{"ip link show wg0", "echo up"}, r.commands)
+	assert.Equal(t, []string{"nameserver 10.0.0.1\n", "nameserver 10.0.0.1\n"}, r.stdin)
+
+	r = &fakeRunner{err: errors.New("denied")}
+	cfg = &Config{Runner: r}
+	assert.EqualError(t, execSh(context.Background(), cfg, "false\ntrue", "wg0", zap.NewNop()), "denied")
+	assert.Equal(t, []string{"false"}, r.commands, "stops at the first failure")
+
+	actions := []Action{}
+	cfg = &Config{Runner: r, plan: &actions}
+	r.commands = nil
+	assert.NoError(t, execSh(context.Background(), cfg, "true", "wg0", zap.NewNop()))
+	assert.Empty(t, r.commands, "dry run doesn't run commands")
+}
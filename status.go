@@ -0,0 +1,52 @@
+package wgquick
+
+import (
+	"net"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// PeerStats is runtime state of a single peer
+type PeerStats struct {
+	PublicKey wgtypes.Key
+	Endpoint  *net.UDPAddr
+	// LastHandshakeTime is zero if there was no handshake yet
+	LastHandshakeTime time.Time
+	ReceiveBytes      int64
+	TransmitBytes     int64
+}
+
+// DeviceStatus reads the live state of the wireguard interface. Mostly equivalent to `wg show iface`
+func DeviceStatus(iface string) (*wgtypes.Device, error) {
+	cl, err := wgctrl.New()
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+	return cl.Device(iface)
+}
+
+// Stats returns runtime stats of all peers on the interface
+func Stats(iface string) ([]PeerStats, error) {
+	dev, err := DeviceStatus(iface)
+	if err != nil {
+		return nil, err
+	}
+	return peerStats(dev), nil
+}
+
+func peerStats(dev *wgtypes.Device) []PeerStats {
+	stats := make([]PeerStats, 0, len(dev.Peers))
+	for _, p := range dev.Peers {
+		stats = append(stats, PeerStats{
+			PublicKey:         p.PublicKey,
+			Endpoint:          p.Endpoint,
+			LastHandshakeTime: p.LastHandshakeTime,
+			ReceiveBytes:      p.ReceiveBytes,
+			TransmitBytes:     p.TransmitBytes,
+		})
+	}
+	return stats
+}
@@ -0,0 +1,40 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestPeerStats(t *testing.T) {
+	pub, err := ParseKey("xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=")
+	assert.NoError(t, err)
+	handshake := time.Date(2019, 12, 6, 12, 0, 0, 0, time.UTC)
+	endpoint := &net.UDPAddr{IP: net.ParseIP("123.12.12.1"), Port: 51820}
+	dev := &wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:         pub,
+				Endpoint:          endpoint,
+				LastHandshakeTime: handshake,
+				ReceiveBytes:      1024,
+				TransmitBytes:     2048,
+			},
+			{},
+		},
+	}
+	assert.Equal(t, []PeerStats{
+		{
+			PublicKey:         pub,
+			Endpoint:          endpoint,
+			LastHandshakeTime: handshake,
+			ReceiveBytes:      1024,
+			TransmitBytes:     2048,
+		},
+		{},
+	}, peerStats(dev))
+}
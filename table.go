@@ -0,0 +1,177 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+const (
+	// firstAutoTable is the first routing table (and firewall mark) considered for default routes when Table is auto, same as wg-quick
+	firstAutoTable = 51820
+	// autoRulePriority is the priority of the first policy rule installed for default routes when Table is auto, unless RulePriority is set
+	autoRulePriority = 32000
+	// srcValidMarkPath makes reverse path filtering consider firewall marks
+	srcValidMarkPath = "/proc/sys/net/ipv4/conf/all/src_valid_mark"
+)
+
+func routeFamily(rt net.IPNet) int {
+	if rt.IP.To4() != nil {
+		return netlink.FAMILY_V4
+	}
+	return netlink.FAMILY_V6
+}
+
+// autoTable returns the routing table used for default routes when Table is auto. Like in wg-quick, the table is the same as the firewall mark.
+// It's the firewall mark from the config or the device if set, otherwise the first unused table starting from 51820
+func autoTable(cfg *Config, iface string) (int, error) {
+	if cfg.FirewallMark != nil && *cfg.FirewallMark != 0 {
+		return *cfg.FirewallMark, nil
+	}
+	cl, err := wgctrl.New()
+	if err != nil {
+		return 0, err
+	}
+	defer cl.Close()
+	dev, err := cl.Device(iface)
+	switch {
+	case err == nil:
+		if dev.FirewallMark != 0 {
+			return dev.FirewallMark, nil
+		}
+	case os.IsNotExist(err) && cfg.dryRun():
+		// device would have been created
+	default:
+		return 0, err
+	}
+	for table := firstAutoTable; ; table++ {
+		routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+		if err != nil {
+			return 0, err
+		}
+		if len(routes) == 0 {
+			return table, nil
+		}
+	}
+}
+
+// autoTableRules are the policy rules making default routes in the given table work without hijacking wireguard's own traffic:
+// * lookup main suppress_prefixlength 0 --> use main table for everything but its default route
+// * fwmark table lookup main --> wireguard's own (marked) packets use the main table
+// * lookup table --> everything else goes through the wireguard default route
+// They get consecutive priorities starting from rulePriority
+func autoTableRules(cfg *Config, table int, family int) []*netlink.Rule {
+	priority := rulePriority(cfg)
+	suppress := netlink.NewRule()
+	suppress.Family = family
+	suppress.Priority = priority
+	suppress.Table = unix.RT_TABLE_MAIN
+	suppress.SuppressPrefixlen = 0
+
+	marked := netlink.NewRule()
+	marked.Family = family
+	marked.Priority = priority + 1
+	marked.Table = unix.RT_TABLE_MAIN
+	marked.Mark = table
+
+	rest := netlink.NewRule()
+	rest.Family = family
+	rest.Priority = priority + 2
+	rest.Table = table
+
+	return []*netlink.Rule{suppress, marked, rest}
+}
+
+func rulePriority(cfg *Config) int {
+	if cfg.RulePriority > 0 {
+		return cfg.RulePriority
+	}
+	return autoRulePriority
+}
+
+func ruleString(rule *netlink.Rule) string {
+	return fmt.Sprintf("family %d priority %d fwmark %d table %d", rule.Family, rule.Priority, rule.Mark, rule.Table)
+}
+
+func ruleExists(present []netlink.Rule, rule *netlink.Rule) bool {
+	for _, r := range present {
+		if r.Priority == rule.Priority && r.Table == rule.Table && r.Mark == rule.Mark {
+			return true
+		}
+	}
+	return false
+}
+
+// syncAutoTableRules adds policy rules for default routes in the given table for each family
+func syncAutoTableRules(cfg *Config, table int, defaultRoutes []net.IPNet, log *zap.Logger) error {
+	for _, rt := range defaultRoutes {
+		family := routeFamily(rt)
+		present, err := netlink.RuleList(family)
+		if err != nil {
+			log.Error("cannot read existing rules", zap.Error(err))
+			return err
+		}
+		for _, rule := range autoTableRules(cfg, table, family) {
+			log := log.With(
+				zap.Int("priority", rule.Priority),
+				zap.Int("table", rule.Table),
+				zap.Int("family", family),
+			)
+			if ruleExists(present, rule) {
+				log.Debug("rule present")
+				continue
+			}
+			if err := cfg.apply(log, "rule add", ruleString(rule), func() error {
+				return netlink.RuleAdd(rule)
+			}); err != nil && err != syscall.EEXIST {
+				log.Error("cannot add rule", zap.Error(err))
+				return err
+			}
+			log.Info("rule added")
+		}
+		if family == netlink.FAMILY_V4 {
+			// the same as wg-quick; otherwise replies to marked packets are dropped by the reverse path filter
+			if err := cfg.apply(log, "write", srcValidMarkPath, func() error {
+				return ioutil.WriteFile(srcValidMarkPath, []byte("1"), 0644)
+			}); err != nil {
+				log.Error("cannot set src_valid_mark", zap.Error(err))
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteAutoTableRules removes the policy rules added by syncAutoTableRules
+func deleteAutoTableRules(cfg *Config, table int, log *zap.Logger) error {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		present, err := netlink.RuleList(family)
+		if err != nil {
+			log.Error("cannot read existing rules", zap.Error(err))
+			return err
+		}
+		for _, rule := range autoTableRules(cfg, table, family) {
+			if !ruleExists(present, rule) {
+				continue
+			}
+			if err := cfg.apply(log, "rule del", ruleString(rule), func() error {
+				return netlink.RuleDel(rule)
+			}); err != nil {
+				log.Error("cannot delete rule", zap.Int("priority", rule.Priority), zap.Error(err))
+				return err
+			}
+			log.Info("rule deleted", zap.Int("priority", rule.Priority), zap.Int("family", family))
+		}
+	}
+	return nil
+}
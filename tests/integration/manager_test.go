@@ -0,0 +1,108 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	wgquick "github.com/uinta-labs/wg-quick-go"
+)
+
+// managedConfig is a config for a Manager test interface, n keeps addresses of several interfaces apart
+func managedConfig(t *testing.T, ns string, n int, postUp string) *wgquick.Config {
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &wgquick.Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.10%d.0.1/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.10%d.1.0/24
+`, privateKey, n, publicKey(t), n))))
+	cfg.PostUp = postUp
+	cfg.Namespace = ns
+	return cfg
+}
+
+// linksExist reports for each interface whether its link exists in the namespace
+func linksExist(t *testing.T, ns string, ifaces ...string) []bool {
+	exists := make([]bool, len(ifaces))
+	inNamespace(t, ns, func() {
+		for i, name := range ifaces {
+			_, err := netlink.LinkByName(name)
+			exists[i] = err == nil
+		}
+	})
+	return exists
+}
+
+func TestManagerUpDown(t *testing.T) {
+	ns := withNamespace(t)
+	ctx := context.Background()
+	m := wgquick.NewManager(zap.NewNop())
+
+	cfg := managedConfig(t, ns, 0, "")
+	if err := m.Up(ctx, cfg, "wg0"); err != nil {
+		if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+			t.Skip("wireguard kernel module not loaded")
+		}
+		t.Fatal(err)
+	}
+	assert.NoError(t, m.Up(ctx, managedConfig(t, ns, 1, ""), "wg1"))
+	assert.Equal(t, []string{"wg0", "wg1"}, m.List())
+	assert.NoError(t, m.Tag("wg0", "mesh"))
+	assert.NoError(t, m.Tag("wg1", "mesh"))
+
+	// the Manager keeps its own copy
+	cfg.MTU = 1280
+	kept, err := m.Config("wg0")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, kept.MTU)
+	}
+	stats := m.Stats()
+	assert.Len(t, stats["wg0"], 1)
+	assert.Len(t, stats["wg1"], 1)
+
+	assert.NoError(t, m.Down(ctx, "wg0"))
+	assert.Equal(t, []string{"wg1"}, m.List())
+	assert.Equal(t, []string{"wg1"}, m.Group("mesh"))
+	assert.Equal(t, []bool{false, true}, linksExist(t, ns, "wg0", "wg1"))
+
+	assert.NoError(t, m.DownGroup(ctx, "mesh"))
+	assert.Empty(t, m.List())
+	assert.Empty(t, m.Group("mesh"))
+	assert.Equal(t, []bool{false, false}, linksExist(t, ns, "wg0", "wg1"))
+}
+
+func TestManagerUpGroupRollsBack(t *testing.T) {
+	ns := withNamespace(t)
+	ctx := context.Background()
+	m := wgquick.NewManager(zap.NewNop())
+
+	err := m.UpGroup(ctx, "mesh", map[string]*wgquick.Config{
+		"wg0": managedConfig(t, ns, 0, ""),
+		"wg1": managedConfig(t, ns, 1, ""),
+		"wg2": managedConfig(t, ns, 2, "false"),
+	})
+	if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+		t.Skip("wireguard kernel module not loaded")
+	}
+	assert.True(t, errors.Is(err, wgquick.ErrHook), "%v", err)
+
+	assert.Empty(t, m.List())
+	assert.Empty(t, m.Group("mesh"))
+	assert.Equal(t, []bool{false, false, false}, linksExist(t, ns, "wg0", "wg1", "wg2"), "group members left behind")
+}
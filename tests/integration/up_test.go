@@ -0,0 +1,669 @@
+//go:build integration
+// +build integration
+
+// Package integration brings up real wireguard interfaces in a throwaway network namespace. It needs root and the wireguard kernel module:
+//
+//	sudo go test -tags integration ./tests/integration/
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	wgquick "github.com/uinta-labs/wg-quick-go"
+)
+
+const iface = "wg0"
+
+// withNamespace creates a named network namespace (as `ip netns add` does) for the test, deleting it afterwards
+func withNamespace(t *testing.T) string {
+	if os.Geteuid() != 0 {
+		t.Skip("integration tests need root")
+	}
+	name := fmt.Sprintf("wgquick-test-%d", os.Getpid())
+	if out, err := exec.Command("ip", "netns", "add", name).CombinedOutput(); err != nil {
+		t.Fatalf("cannot create namespace: %v: %s", err, out)
+	}
+	t.Cleanup(func() {
+		if out, err := exec.Command("ip", "netns", "delete", name).CombinedOutput(); err != nil {
+			t.Errorf("cannot delete namespace: %v: %s", err, out)
+		}
+	})
+	return name
+}
+
+// inNamespace runs fn with the calling thread in the namespace
+func inNamespace(t *testing.T, name string, fn func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Close()
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	if err := netns.Set(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := netns.Set(orig); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	fn()
+}
+
+func publicKey(t *testing.T) wgtypes.Key {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.PublicKey()
+}
+
+// plainLink adds a bridge to the namespace, for tests needing a link which isn't wireguard
+func plainLink(t *testing.T, ns, name string) netlink.Link {
+	var link netlink.Link
+	inNamespace(t, ns, func() {
+		link = &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: name}}
+		if err := netlink.LinkAdd(link); err != nil {
+			if errors.Is(err, syscall.EOPNOTSUPP) {
+				t.Skip("bridge links not supported")
+			}
+			t.Fatal(err)
+		}
+	})
+	return link
+}
+
+// recordingRunner records the commands instead of running them, and whether the link existed at the time
+type recordingRunner struct {
+	commands   []string
+	linkExists []bool
+}
+
+func (r *recordingRunner) Run(ctx context.Context, command string, stdin string) ([]byte, error) {
+	_, err := netlink.LinkByName(iface)
+	r.commands = append(r.commands, command)
+	r.linkExists = append(r.linkExists, err == nil)
+	return nil, nil
+}
+
+func TestUpDown(t *testing.T) {
+	ns := withNamespace(t)
+	log := zap.NewNop()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer1, peer2 := publicKey(t), publicKey(t)
+	cfg := &wgquick.Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.100.0.1/24, fd00:100::1/64
+ListenPort = 51820
+MTU = 1380
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.1.0/24
+Endpoint = 192.0.2.1:51820
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.2.0/24, fd00:200::/64
+`, privateKey, peer1, peer2))))
+	cfg.Namespace = ns
+
+	res, err := wgquick.UpResultContext(context.Background(), cfg, iface, log)
+	if err != nil {
+		if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+			t.Skip("wireguard kernel module not loaded")
+		}
+		t.Fatal(err)
+	}
+
+	inNamespace(t, ns, func() {
+		link, err := netlink.LinkByName(iface)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if assert.NotNil(t, res.Link) {
+			assert.Equal(t, link.Attrs().Index, res.Link.Attrs().Index)
+		}
+		assert.Equal(t, "wireguard", link.Type())
+		assert.NotZero(t, link.Attrs().Flags&net.FlagUp)
+		assert.Equal(t, 1380, link.Attrs().MTU)
+
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		assert.NoError(t, err)
+		var gotAddrs []string
+		for _, addr := range addrs {
+			if !addr.IP.IsLinkLocalUnicast() {
+				gotAddrs = append(gotAddrs, addr.IPNet.String())
+			}
+		}
+		assert.ElementsMatch(t, []string{"10.100.0.1/24", "fd00:100::1/64"}, gotAddrs)
+
+		routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+		assert.NoError(t, err)
+		var gotRoutes []string
+		for _, rt := range routes {
+			if rt.Dst != nil && rt.Protocol == wgquick.DefaultRouteProtocol {
+				gotRoutes = append(gotRoutes, rt.Dst.String())
+			}
+		}
+		assert.ElementsMatch(t, []string{"10.100.1.0/24", "10.100.2.0/24", "fd00:200::/64"}, gotRoutes)
+
+		dev, err := wgquick.DeviceStatus(iface)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, privateKey, dev.PrivateKey)
+		assert.Equal(t, 51820, dev.ListenPort)
+		peers := make(map[wgtypes.Key]wgtypes.Peer)
+		for _, p := range dev.Peers {
+			peers[p.PublicKey] = p
+		}
+		if assert.Len(t, peers, 2) {
+			assert.Equal(t, "192.0.2.1:51820", peers[peer1].Endpoint.String())
+			assert.Equal(t, "25s", peers[peer1].PersistentKeepaliveInterval.String())
+			assert.Len(t, peers[peer2].AllowedIPs, 2)
+		}
+
+		live, err := wgquick.FromInterface(iface)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, privateKey, *live.PrivateKey)
+		assert.Equal(t, 51820, *live.ListenPort)
+		assert.Equal(t, 1380, live.MTU)
+		assert.Len(t, live.Peers, 2)
+		var liveAddrs []string
+		for _, addr := range live.Address {
+			liveAddrs = append(liveAddrs, addr.String())
+		}
+		assert.ElementsMatch(t, []string{"10.100.0.1/24", "fd00:100::1/64"}, liveAddrs)
+	})
+
+	diff, err := wgquick.Diff(cfg, iface)
+	if assert.NoError(t, err) {
+		assert.True(t, diff.Empty(), "%+v", diff)
+	}
+
+	// received, transmitted and up for both peers, no handshakes yet
+	metrics, err := wgquick.NewCollector(cfg, iface).Collect()
+	if assert.NoError(t, err) {
+		assert.Len(t, metrics, 6)
+	}
+
+	assert.NoError(t, wgquick.Down(cfg, iface, log))
+	inNamespace(t, ns, func() {
+		_, err := netlink.LinkByName(iface)
+		assert.IsType(t, netlink.LinkNotFoundError{}, err)
+	})
+}
+
+func TestUpDefaultRoute(t *testing.T) {
+	ns := withNamespace(t)
+	log := zap.NewNop()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &wgquick.Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.100.0.1/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 0.0.0.0/0
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.1.0/24
+`, privateKey, publicKey(t), publicKey(t)))))
+	cfg.Namespace = ns
+
+	res, err := wgquick.UpResultContext(context.Background(), cfg, iface, log)
+	if err != nil {
+		if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+			t.Skip("wireguard kernel module not loaded")
+		}
+		t.Fatal(err)
+	}
+	mark := res.FirewallMark
+	assert.NotZero(t, mark)
+
+	ownRoutes := func(table int) []string {
+		routes, err := netlink.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+		assert.NoError(t, err)
+		var got []string
+		for _, rt := range routes {
+			if rt.Protocol == wgquick.DefaultRouteProtocol {
+				got = append(got, rt.Dst.String())
+			}
+		}
+		return got
+	}
+	markRules := func() int {
+		rules, err := netlink.RuleList(netlink.FAMILY_V4)
+		assert.NoError(t, err)
+		n := 0
+		for _, rule := range rules {
+			if rule.Table == mark || rule.Mark == mark {
+				n++
+			}
+		}
+		return n
+	}
+	inNamespace(t, ns, func() {
+		// the default route goes to the fwmark table, the main table only gets the other peer's route
+		assert.Equal(t, []string{"0.0.0.0/0"}, ownRoutes(mark))
+		assert.Equal(t, []string{"10.100.1.0/24"}, ownRoutes(unix.RT_TABLE_MAIN))
+		assert.Equal(t, 2, markRules(), "rules for marked and unmarked packets")
+
+		dev, err := wgquick.DeviceStatus(iface)
+		if assert.NoError(t, err) {
+			assert.Equal(t, mark, dev.FirewallMark)
+		}
+	})
+
+	assert.NoError(t, wgquick.Down(cfg, iface, log))
+	inNamespace(t, ns, func() {
+		assert.Zero(t, markRules(), "rules left behind by Down")
+	})
+}
+
+func TestSyncRemovesPeer(t *testing.T) {
+	ns := withNamespace(t)
+	log := zap.NewNop()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, removed := publicKey(t), publicKey(t)
+	cfg := &wgquick.Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.100.0.1/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.1.0/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.2.0/24
+`, privateKey, kept, removed))))
+	cfg.Namespace = ns
+
+	if err := wgquick.Up(cfg, iface, log); err != nil {
+		if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+			t.Skip("wireguard kernel module not loaded")
+		}
+		t.Fatal(err)
+	}
+	defer func() {
+		assert.NoError(t, wgquick.Down(cfg, iface, log))
+	}()
+
+	cfg.Peers = cfg.Peers[:1]
+	assert.NoError(t, wgquick.Sync(cfg, iface, log))
+
+	inNamespace(t, ns, func() {
+		dev, err := wgquick.DeviceStatus(iface)
+		if assert.NoError(t, err) && assert.Len(t, dev.Peers, 1) {
+			assert.Equal(t, kept, dev.Peers[0].PublicKey)
+		}
+
+		link, err := netlink.LinkByName(iface)
+		if !assert.NoError(t, err) {
+			return
+		}
+		routes, err := netlink.RouteList(link, netlink.FAMILY_V4)
+		assert.NoError(t, err)
+		var got []string
+		for _, rt := range routes {
+			if rt.Dst != nil && rt.Protocol == wgquick.DefaultRouteProtocol {
+				got = append(got, rt.Dst.String())
+			}
+		}
+		assert.Equal(t, []string{"10.100.1.0/24"}, got)
+	})
+}
+
+func TestSyncRemovesAddress(t *testing.T) {
+	ns := withNamespace(t)
+	log := zap.NewNop()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &wgquick.Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.100.0.1/24, 10.200.0.1/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.1.0/24
+`, privateKey, publicKey(t)))))
+	cfg.Namespace = ns
+
+	if err := wgquick.Up(cfg, iface, log); err != nil {
+		if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+			t.Skip("wireguard kernel module not loaded")
+		}
+		t.Fatal(err)
+	}
+	defer func() {
+		assert.NoError(t, wgquick.Down(cfg, iface, log))
+	}()
+
+	cfg.Address = cfg.Address[:1]
+	assert.NoError(t, wgquick.Sync(cfg, iface, log))
+
+	inNamespace(t, ns, func() {
+		link, err := netlink.LinkByName(iface)
+		if !assert.NoError(t, err) {
+			return
+		}
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		assert.NoError(t, err)
+		var got []string
+		for _, addr := range addrs {
+			got = append(got, addr.IPNet.String())
+		}
+		assert.Equal(t, []string{"10.100.0.1/24"}, got)
+	})
+}
+
+func TestSyncRemovesPeerTable(t *testing.T) {
+	ns := withNamespace(t)
+	log := zap.NewNop()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant := publicKey(t)
+	cfg := &wgquick.Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.100.0.1/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.1.0/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.2.0/24
+`, privateKey, publicKey(t), tenant))))
+	cfg.Namespace = ns
+	cfg.PeerTables = map[wgtypes.Key]int{tenant: 100}
+
+	if err := wgquick.Up(cfg, iface, log); err != nil {
+		if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+			t.Skip("wireguard kernel module not loaded")
+		}
+		t.Fatal(err)
+	}
+	defer func() {
+		assert.NoError(t, wgquick.Down(cfg, iface, log))
+	}()
+
+	tableRoutes := func(table int) []string {
+		routes, err := netlink.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+		assert.NoError(t, err)
+		var got []string
+		for _, rt := range routes {
+			if rt.Dst != nil && rt.Protocol == wgquick.DefaultRouteProtocol {
+				got = append(got, rt.Dst.String())
+			}
+		}
+		return got
+	}
+	inNamespace(t, ns, func() {
+		assert.Equal(t, []string{"10.100.2.0/24"}, tableRoutes(100))
+	})
+
+	cfg.PeerTables = nil
+	assert.NoError(t, wgquick.Sync(cfg, iface, log))
+	inNamespace(t, ns, func() {
+		assert.Empty(t, tableRoutes(100), "routes left in the table no peer uses")
+		assert.ElementsMatch(t, []string{"10.100.1.0/24", "10.100.2.0/24"}, tableRoutes(unix.RT_TABLE_MAIN))
+	})
+}
+
+func TestSyncAddressChangedPrefix(t *testing.T) {
+	ns := withNamespace(t)
+	link := plainLink(t, ns, iface)
+	log := zap.NewNop()
+
+	inNamespace(t, ns, func() {
+		cfg := &wgquick.Config{Address: []net.IPNet{{IP: net.ParseIP("10.100.0.1"), Mask: net.CIDRMask(24, 32)}}}
+		assert.NoError(t, wgquick.SyncAddress(cfg, link, log))
+		// same again is a no-op
+		assert.NoError(t, wgquick.SyncAddress(cfg, link, log))
+
+		cfg.Address[0].Mask = net.CIDRMask(16, 32)
+		assert.NoError(t, wgquick.SyncAddress(cfg, link, log))
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		assert.NoError(t, err)
+		if assert.Len(t, addrs, 1) {
+			assert.Equal(t, "10.100.0.1/16", addrs[0].IPNet.String())
+		}
+	})
+}
+
+func TestUpRollsBack(t *testing.T) {
+	_, conflict, _ := net.ParseCIDR("10.100.1.0/24")
+	for _, tc := range []struct {
+		name string
+		step error
+		// setup makes Up fail
+		setup func(t *testing.T, ns string, cfg *wgquick.Config)
+		// kept are routes of another link which must survive the rollback
+		kept []string
+	}{
+		{
+			name: "hook",
+			step: wgquick.ErrHook,
+			setup: func(t *testing.T, ns string, cfg *wgquick.Config) {
+				cfg.PostUp = "false"
+			},
+		},
+		{
+			name: "route conflict",
+			step: wgquick.ErrRouteSync,
+			setup: func(t *testing.T, ns string, cfg *wgquick.Config) {
+				cfg.RouteConflict = wgquick.RouteConflictError
+				other := plainLink(t, ns, "br0")
+				inNamespace(t, ns, func() {
+					if err := netlink.LinkSetUp(other); err != nil {
+						t.Fatal(err)
+					}
+					if err := netlink.RouteAdd(&netlink.Route{LinkIndex: other.Attrs().Index, Dst: conflict}); err != nil {
+						t.Fatal(err)
+					}
+				})
+			},
+			kept: []string{"10.100.1.0/24"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ns := withNamespace(t)
+			log := zap.NewNop()
+
+			privateKey, err := wgtypes.GeneratePrivateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &wgquick.Config{}
+			assert.NoError(t, cfg.UnmarshalText([]byte(fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.100.0.1/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.1.0/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.2.0/24
+`, privateKey, publicKey(t), publicKey(t)))))
+			cfg.Namespace = ns
+			tc.setup(t, ns, cfg)
+
+			err = wgquick.Up(cfg, iface, log)
+			if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+				t.Skip("wireguard kernel module not loaded")
+			}
+			var stepErr *wgquick.StepError
+			if assert.True(t, errors.As(err, &stepErr), "%v", err) {
+				assert.Equal(t, tc.step, stepErr.Step)
+			}
+
+			inNamespace(t, ns, func() {
+				exists, err := wgquick.InterfaceExists(iface)
+				assert.NoError(t, err)
+				assert.False(t, exists, "link left behind by failed Up")
+
+				addrs, err := netlink.AddrList(nil, netlink.FAMILY_ALL)
+				assert.NoError(t, err)
+				for _, addr := range addrs {
+					assert.NotEqual(t, "10.100.0.1/24", addr.IPNet.String(), "address left behind by failed Up")
+				}
+
+				routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: unix.RT_TABLE_UNSPEC}, netlink.RT_FILTER_TABLE)
+				assert.NoError(t, err)
+				var kept []string
+				for _, rt := range routes {
+					assert.NotEqual(t, wgquick.DefaultRouteProtocol, rt.Protocol, "route %s left behind by failed Up", rt.Dst)
+					if rt.Dst != nil && rt.Dst.String() == conflict.String() {
+						kept = append(kept, rt.Dst.String())
+					}
+				}
+				assert.Equal(t, tc.kept, kept, "routes of other links must be kept")
+			})
+		})
+	}
+}
+
+func TestUpExistingNotWireguard(t *testing.T) {
+	ns := withNamespace(t)
+	plainLink(t, ns, iface)
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &wgquick.Config{Config: wgtypes.Config{PrivateKey: &privateKey}, Namespace: ns}
+	err = wgquick.Up(cfg, iface, zap.NewNop())
+	assert.True(t, errors.Is(err, os.ErrExist), "%v", err)
+	assert.True(t, errors.Is(err, wgquick.ErrNotWireguard), "%v", err)
+}
+
+func TestDownOrder(t *testing.T) {
+	ns := withNamespace(t)
+	plainLink(t, ns, iface)
+
+	runner := &recordingRunner{}
+	cfg := &wgquick.Config{
+		DNS:        []net.IP{net.ParseIP("10.0.0.1")},
+		DNSBackend: wgquick.DNSResolvectl,
+		PreDown:    "echo pre-down %i",
+		PostDown:   "echo post-down %i",
+		Runner:     runner,
+		Namespace:  ns,
+	}
+	actions, err := wgquick.PlanDown(cfg, iface, zap.NewNop())
+	assert.NoError(t, err)
+	assert.Equal(t, []wgquick.Action{
+		{Op: "exec", Args: "echo pre-down wg0"},
+		{Op: "exec", Args: "resolvectl revert wg0"},
+		{Op: "link del", Args: "wg0"},
+		{Op: "exec", Args: "echo post-down wg0"},
+	}, actions)
+	assert.Empty(t, runner.commands, "dry run doesn't run commands")
+
+	assert.NoError(t, wgquick.Down(cfg, iface, zap.NewNop()))
+	assert.Equal(t, []string{"echo pre-down wg0", "resolvectl revert wg0", "echo post-down wg0"}, runner.commands)
+	// DNS is reverted while the link still exists, PostDown runs after it's gone
+	assert.Equal(t, []bool{true, true, false}, runner.linkExists)
+}
+
+// openFDs is the number of file descriptors open in the test process
+func openFDs(t *testing.T) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(fds)
+}
+
+func TestUpDownNoFDLeak(t *testing.T) {
+	ns := withNamespace(t)
+	log := zap.NewNop()
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &wgquick.Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(fmt.Sprintf(`[Interface]
+PrivateKey = %s
+Address = 10.100.0.1/24
+
+[Peer]
+PublicKey = %s
+AllowedIPs = 10.100.1.0/24
+`, privateKey, publicKey(t)))))
+	cfg.Namespace = ns
+
+	cycle := func() {
+		if err := wgquick.Up(cfg, iface, log); err != nil {
+			if errors.Is(err, wgquick.ErrModuleNotLoaded) {
+				t.Skip("wireguard kernel module not loaded")
+			}
+			t.Fatal(err)
+		}
+		if err := wgquick.Down(cfg, iface, log); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// sockets opened once and cached, e.g. by netlink, don't count
+	cycle()
+	before := openFDs(t)
+	for i := 0; i < 20; i++ {
+		cycle()
+	}
+	assert.Equal(t, before, openFDs(t), "file descriptors leaked by Up/Down")
+}
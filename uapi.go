@@ -0,0 +1,40 @@
+package wgquick
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MarshalUAPI encodes the wireguard part of the config in the UAPI `key=value` format of a set operation, e.g. to write to a wireguard-go UAPI socket.
+// Like `wg setconf` with a stripped config, the config replaces the device's peers and each peer's AllowedIPs.
+// Only the body is returned, the caller wraps it into "set=1\n" and a terminating empty line. Interface settings like Address, DNS or hooks aren't part of UAPI
+func (cfg *Config) MarshalUAPI() ([]byte, error) {
+	b := &bytes.Buffer{}
+	if cfg.PrivateKey != nil {
+		fmt.Fprintf(b, "private_key=%s\n", serializeKeyHex(cfg.PrivateKey))
+	}
+	if cfg.ListenPort != nil {
+		fmt.Fprintf(b, "listen_port=%d\n", *cfg.ListenPort)
+	}
+	if cfg.FirewallMark != nil {
+		fmt.Fprintf(b, "fwmark=%d\n", *cfg.FirewallMark)
+	}
+	fmt.Fprintf(b, "replace_peers=true\n")
+	for _, peer := range cfg.Peers {
+		fmt.Fprintf(b, "public_key=%s\n", serializeKeyHex(&peer.PublicKey))
+		if peer.PresharedKey != nil {
+			fmt.Fprintf(b, "preshared_key=%s\n", serializeKeyHex(peer.PresharedKey))
+		}
+		if peer.Endpoint != nil {
+			fmt.Fprintf(b, "endpoint=%s\n", peer.Endpoint)
+		}
+		if peer.PersistentKeepaliveInterval != nil {
+			fmt.Fprintf(b, "persistent_keepalive_interval=%d\n", toSeconds(*peer.PersistentKeepaliveInterval))
+		}
+		fmt.Fprintf(b, "replace_allowed_ips=true\n")
+		for _, ip := range peer.AllowedIPs {
+			fmt.Fprintf(b, "allowed_ip=%s\n", ip.String())
+		}
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,44 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalUAPI(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+FwMark = 0xca6c
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+PresharedKey = /UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=
+Endpoint = 192.95.5.67:1234
+PersistentKeepalive = 25
+AllowedIPs = 10.192.122.3/32, 10.192.124.0/24
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = fd00::/64
+`)))
+	b, err := cfg.MarshalUAPI()
+	assert.NoError(t, err)
+	assert.Equal(t, `private_key=c809f3e5317e9575c9b5ed78b638b7ce530dabe85ddab614220241801ddf0669
+listen_port=51820
+fwmark=51820
+replace_peers=true
+public_key=c53201039adba14be71f886da1d8dbe9eebded08cb111b75340078999aa9f038
+preshared_key=fd4c1c48f837f215bf0fd637b5c4b514e5742b5c2e51131b4b4b1eb0910fe5a9
+endpoint=192.95.5.67:1234
+persistent_keepalive_interval=25
+replace_allowed_ips=true
+allowed_ip=10.192.122.3/32
+allowed_ip=10.192.124.0/24
+public_key=4eb32f4a83f88d842563a448cc181bb2c42a637bf12363e2fb2ef594e5965d7d
+replace_allowed_ips=true
+allowed_ip=fd00::/64
+`, string(b))
+}
@@ -0,0 +1,44 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// uapiDir is where userspace implementations put their control sockets, wgctrl looks for devices there
+const uapiDir = "/var/run/wireguard"
+
+// createUserspaceLink runs cfg.Userspace to create the TUN device. Userspace implementations (like wireguard-go) daemonize and
+// keep running until the device is deleted
+func createUserspaceLink(cfg *Config, iface string, log *zap.Logger) error {
+	return cfg.apply(log, "exec", cfg.Userspace+" "+iface, func() error {
+		out, err := exec.Command(cfg.Userspace, iface).CombinedOutput()
+		if err != nil {
+			log.Error("failed to execute userspace implementation",
+				zap.String("cmd", cfg.Userspace),
+				zap.ByteString("output", out),
+				zap.Error(err),
+			)
+			return fmt.Errorf("%s %s: %v", cfg.Userspace, iface, err)
+		}
+		log.Info("started userspace implementation", zap.String("cmd", cfg.Userspace), zap.ByteString("output", out))
+		return nil
+	})
+}
+
+// isUserspaceLink reports whether link is a TUN device driven by a userspace wireguard implementation
+func isUserspaceLink(link netlink.Link) bool {
+	if link.Type() != "tuntap" {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(uapiDir, link.Attrs().Name+".sock"))
+	return err == nil && fi.Mode()&os.ModeSocket != 0
+}
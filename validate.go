@@ -0,0 +1,147 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// minIPv6MTU is the minimum MTU required by IPv6, see RFC 8200
+const minIPv6MTU = 1280
+
+// ValidationError lists all problems found by Validate
+type ValidationError []error
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the config for common mistakes which would otherwise fail midway through Up, or silently misbehave:
+// * missing private key, unless PrivateKeyFile is set
+// * addresses without masks
+// * address specs for addresses not in Address
+// * MTU out of range, negative MTUOverhead
+// * routes without destination prefix or with a gateway of a different family
+// * rules without table or mixing address families
+// * duplicate peer public keys
+// * the same AllowedIPs on multiple peers. Nested prefixes are fine, wireguard picks the longest match
+// * AllowedIPs narrower than an interface address' subnet covering the address itself, e.g. a peer with 10.0.0.2/32 on 10.0.0.2/24,
+// or the interface's own host address copied into a peer, 10.0.0.2/32 on 10.0.0.2/32. Covering it with the whole subnet or a default route is the usual setup and fine
+// All problems are returned together as ValidationError
+func (cfg *Config) Validate() error {
+	var errs ValidationError
+	if cfg.PrivateKeyFile == "" && (cfg.PrivateKey == nil || *cfg.PrivateKey == (wgtypes.Key{})) {
+		errs = append(errs, fmt.Errorf("missing PrivateKey"))
+	}
+
+	hasIPv6 := false
+	for _, addr := range cfg.Address {
+		if addr.Mask == nil {
+			errs = append(errs, fmt.Errorf("address %s has no mask", addr.IP))
+			continue
+		}
+		if addr.IP.To4() == nil {
+			hasIPv6 = true
+		}
+	}
+
+	for addr := range cfg.AddressSpecs {
+		if !hasAddress(cfg, addr) {
+			errs = append(errs, fmt.Errorf("address spec %s doesn't match any Address", addr))
+		}
+	}
+
+	switch {
+	case cfg.MTU < 0 || cfg.MTU > 65535:
+		errs = append(errs, fmt.Errorf("MTU %d out of range", cfg.MTU))
+	case cfg.MTU != 0 && hasIPv6 && cfg.MTU < minIPv6MTU:
+		errs = append(errs, fmt.Errorf("MTU %d is below %d required for IPv6 addresses", cfg.MTU, minIPv6MTU))
+	}
+	if cfg.RulePriority < 0 {
+		errs = append(errs, fmt.Errorf("RulePriority %d is negative", cfg.RulePriority))
+	}
+	if cfg.MTUOverhead < 0 {
+		errs = append(errs, fmt.Errorf("MTUOverhead %d is negative", cfg.MTUOverhead))
+	}
+
+	for _, r := range cfg.Routes {
+		if r.Dst.IP == nil || r.Dst.Mask == nil {
+			errs = append(errs, fmt.Errorf("route %s has no destination prefix", r.Dst.String()))
+			continue
+		}
+		if r.Gw != nil && (r.Gw.To4() == nil) != (r.Dst.IP.To4() == nil) {
+			errs = append(errs, fmt.Errorf("route %s has gateway %s of a different family", r.Dst.String(), r.Gw))
+		}
+	}
+
+	for _, r := range cfg.Rules {
+		if r.Table <= 0 {
+			errs = append(errs, fmt.Errorf("rule has no table"))
+		}
+		if r.Src != nil && r.Dst != nil && (r.Src.IP.To4() == nil) != (r.Dst.IP.To4() == nil) {
+			errs = append(errs, fmt.Errorf("rule from %s to %s mixes address families", r.Src, r.Dst))
+		}
+	}
+
+	for key, table := range cfg.PeerTables {
+		if table <= 0 {
+			errs = append(errs, fmt.Errorf("invalid table %d for peer %s", table, key))
+		}
+	}
+
+	peers := make(map[wgtypes.Key]bool, len(cfg.Peers))
+	allowedIPs := make(map[string]wgtypes.Key)
+	for _, peer := range cfg.Peers {
+		if peers[peer.PublicKey] {
+			errs = append(errs, fmt.Errorf("duplicate peer %s", peer.PublicKey))
+		}
+		peers[peer.PublicKey] = true
+		for _, ip := range peer.AllowedIPs {
+			prefix := (&net.IPNet{IP: ip.IP.Mask(ip.Mask), Mask: ip.Mask}).String()
+			if other, ok := allowedIPs[prefix]; ok && other != peer.PublicKey {
+				errs = append(errs, fmt.Errorf("AllowedIPs %s on both peer %s and %s", prefix, other, peer.PublicKey))
+			}
+			allowedIPs[prefix] = peer.PublicKey
+			if addr := coveredAddress(cfg, ip); addr != nil {
+				errs = append(errs, fmt.Errorf("AllowedIPs %s of peer %s covers the interface address %s", prefix, peer.PublicKey, addr))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func hasAddress(cfg *Config, addr string) bool {
+	for _, a := range cfg.Address {
+		if a.String() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// coveredAddress is the interface address ip contains with a longer prefix than the address' own subnet, or the same host prefix, if any
+func coveredAddress(cfg *Config, ip net.IPNet) *net.IPNet {
+	if ip.Mask == nil {
+		return nil
+	}
+	ones, bits := ip.Mask.Size()
+	for i, addr := range cfg.Address {
+		if addr.Mask == nil || !ip.Contains(addr.IP) {
+			continue
+		}
+		if addrOnes, _ := addr.Mask.Size(); ones > addrOnes || ones == bits {
+			return &cfg.Address[i]
+		}
+	}
+	return nil
+}
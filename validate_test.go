@@ -0,0 +1,83 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	for name, cfg := range testConfigs {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			assert.NoError(t, c.UnmarshalText([]byte(cfg)))
+			assert.NoError(t, c.Validate())
+		})
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`[Interface]
+Address = fd00::1/64
+MTU = 1000
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.0/24
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.0.0.1/24
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.1.0.0/24
+`)))
+	err := c.Validate()
+	if assert.IsType(t, ValidationError{}, err) {
+		assert.Len(t, err, 4)
+	}
+	assert.Contains(t, err.Error(), "missing PrivateKey")
+	assert.Contains(t, err.Error(), "MTU 1000")
+	assert.Contains(t, err.Error(), "duplicate peer")
+	assert.Contains(t, err.Error(), "AllowedIPs 10.0.0.0/24")
+}
+
+func TestValidateAllowedIPsCoverAddress(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+Address = 10.0.0.2/24, fd00::2/64
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.0/24, 0.0.0.0/0, ::/0
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.0.0.2/32, fd00::/120
+`)))
+	err := c.Validate()
+	if assert.IsType(t, ValidationError{}, err) {
+		assert.Len(t, err, 2)
+	}
+	assert.Contains(t, err.Error(), "AllowedIPs 10.0.0.2/32 of peer TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0= covers the interface address 10.0.0.2/24")
+	assert.Contains(t, err.Error(), "AllowedIPs fd00::/120")
+
+	c = &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+Address = 10.0.0.2/32, fd00::2/128
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.2/32, fd00::2/128, 10.0.0.0/24
+`)))
+	err = c.Validate()
+	if assert.IsType(t, ValidationError{}, err) {
+		assert.Len(t, err, 2)
+	}
+	assert.Contains(t, err.Error(), "AllowedIPs 10.0.0.2/32 of peer xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg= covers the interface address 10.0.0.2/32")
+	assert.Contains(t, err.Error(), "AllowedIPs fd00::2/128 of peer")
+}
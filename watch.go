@@ -0,0 +1,103 @@
+package wgquick
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// watchDebounce is how many polls in a row a peer must be seen in a new state before the change is reported, so flapping peers don't spam callbacks
+const watchDebounce = 2
+
+// PeerEvent is a peer liveness change reported by Watch
+type PeerEvent struct {
+	PublicKey wgtypes.Key
+	// Up is true if the last handshake is recent enough for the session to be alive, see wireguard_peer_up in Collector
+	Up                bool
+	LastHandshakeTime time.Time
+	Endpoint          *net.UDPAddr
+}
+
+// Watch polls the interface every interval and calls fn when a peer goes up or down. The initial state of each peer is reported once as it's first seen.
+// A change is only reported after it was seen on consecutive polls. fn is called from a single goroutine.
+// Read failures are logged and retried on the next tick. Call the returned func to stop it, it's safe to call more than once.
+func Watch(iface string, interval time.Duration, fn func(PeerEvent), logger *zap.Logger) (stop func()) {
+	log := ifaceLogger(logger, iface)
+	states := make(map[wgtypes.Key]*peerState)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			dev, err := DeviceStatus(iface)
+			if err != nil {
+				log.Error("cannot read wireguard device", zap.Error(err))
+			} else {
+				for _, ev := range peerTransitions(states, dev, time.Now()) {
+					fn(ev)
+				}
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+type peerState struct {
+	up bool
+	// changed counts the polls in a row the peer was seen in the other state
+	changed int
+}
+
+// peerTransitions updates states with the device's peers and returns the events to report, sorted by public key.
+// Peers no longer on the device are forgotten
+func peerTransitions(states map[wgtypes.Key]*peerState, dev *wgtypes.Device, now time.Time) []PeerEvent {
+	var events []PeerEvent
+	present := make(map[wgtypes.Key]bool, len(dev.Peers))
+	for _, p := range dev.Peers {
+		present[p.PublicKey] = true
+		up := !p.LastHandshakeTime.IsZero() && now.Sub(p.LastHandshakeTime) < handshakeTimeout
+		ev := PeerEvent{PublicKey: p.PublicKey, Up: up, LastHandshakeTime: p.LastHandshakeTime, Endpoint: p.Endpoint}
+
+		st, ok := states[p.PublicKey]
+		switch {
+		case !ok:
+			states[p.PublicKey] = &peerState{up: up}
+			events = append(events, ev)
+		case st.up == up:
+			st.changed = 0
+		default:
+			st.changed++
+			if st.changed >= watchDebounce {
+				st.up = up
+				st.changed = 0
+				events = append(events, ev)
+			}
+		}
+	}
+	for key := range states {
+		if !present[key] {
+			delete(states, key)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].PublicKey.String() < events[j].PublicKey.String()
+	})
+	return events
+}
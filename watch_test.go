@@ -0,0 +1,43 @@
+package wgquick
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestPeerTransitions(t *testing.T) {
+	pub, err := ParseKey("xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=")
+	assert.NoError(t, err)
+	handshake := time.Date(2019, 12, 6, 12, 0, 0, 0, time.UTC)
+	dev := &wgtypes.Device{Peers: []wgtypes.Peer{{PublicKey: pub, LastHandshakeTime: handshake}}}
+	states := make(map[wgtypes.Key]*peerState)
+
+	// initial state is reported
+	events := peerTransitions(states, dev, handshake.Add(time.Minute))
+	assert.Equal(t, []PeerEvent{{PublicKey: pub, Up: true, LastHandshakeTime: handshake}}, events)
+	assert.Empty(t, peerTransitions(states, dev, handshake.Add(2*time.Minute)))
+
+	// stale once, then fresh again: flapping isn't reported
+	assert.Empty(t, peerTransitions(states, dev, handshake.Add(4*time.Minute)))
+	dev.Peers[0].LastHandshakeTime = handshake.Add(4 * time.Minute)
+	assert.Empty(t, peerTransitions(states, dev, handshake.Add(5*time.Minute)))
+
+	// stale on consecutive polls
+	assert.Empty(t, peerTransitions(states, dev, handshake.Add(10*time.Minute)))
+	events = peerTransitions(states, dev, handshake.Add(11*time.Minute))
+	assert.Equal(t, []PeerEvent{{PublicKey: pub, Up: false, LastHandshakeTime: handshake.Add(4 * time.Minute)}}, events)
+
+	dev.Peers = nil
+	assert.Empty(t, peerTransitions(states, dev, handshake))
+	assert.Empty(t, states)
+}
+
+func TestWatchStopTwice(t *testing.T) {
+	stop := Watch("wgquicktest-missing", time.Hour, func(PeerEvent) {}, zap.NewNop())
+	stop()
+	assert.NotPanics(t, stop)
+}
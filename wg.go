@@ -1,177 +1,642 @@
+//go:build linux
+// +build linux
+
 package wgquick
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
-	"strings"
-	"syscall"
+	"sort"
 
 	"github.com/vishvananda/netlink"
 	"go.uber.org/zap"
 	"golang.org/x/sys/unix"
 	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
+// defaultMTU is the MTU the kernel gives new wireguard links
+const defaultMTU = 1420
+
 // Up sets and configures the wg interface. Mostly equivalent to `wg-quick up iface`
+// The config is validated first, see Config.Validate. Peer endpoint hostnames are resolved again, see Config.ResolveEndpoints.
+// If any later step fails, everything set up so far is rolled back.
+// If the interface already exists and matches the config (as far as Diff compares), Up does nothing, hooks included. Otherwise it fails with os.ErrExist, use Sync to update it.
+// If the existing interface can't be compared, the error is a StepError with Step os.ErrExist wrapping the reason, e.g. ErrNotWireguard
 func Up(cfg *Config, iface string, logger *zap.Logger) error {
-	log := logger.With(zap.String("iface", iface))
-	_, err := netlink.LinkByName(iface)
-	if err == nil {
-		return os.ErrExist
+	return UpContext(context.Background(), cfg, iface, logger)
+}
+
+// UpContext is Up with a context. Cancelling the context kills running hooks and aborts before the next step
+func UpContext(ctx context.Context, cfg *Config, iface string, logger *zap.Logger) error {
+	_, err := UpResultContext(ctx, cfg, iface, logger)
+	return err
+}
+
+// UpResult describes what Up did
+type UpResult struct {
+	// Created is false if the interface already existed and matched the config, nothing was changed then
+	Created bool
+	// Addresses and Routes added to the new link. Routes are the ones in the config's table, as Diff counts them
+	Addresses []net.IPNet
+	Routes    []net.IPNet
+	// Hooks are the hooks that ran, e.g. "PreUp"
+	Hooks []string
+	// ListenPort is the port the device is bound to, the one picked by the kernel if the config has none
+	ListenPort int
+	// FirewallMark is the mark of the device's packets, 0 if none. With Table = auto and default routes it's also the table the default routes are in,
+	// and the mark the policy rules match on, see Sync
+	FirewallMark int
+	// Link is the link as configured by Up, for further netlink configuration such as qdiscs or tc filters without looking it up again.
+	// With Namespace set, its index refers to that namespace, use a netlink.Handle there. Nil in dry runs
+	Link netlink.Link
+}
+
+// UpResultContext is UpContext returning what was set up, e.g. for metrics or audit logs. On error the result covers the steps done before the failure, which have been rolled back
+func UpResultContext(ctx context.Context, cfg *Config, iface string, logger *zap.Logger) (*UpResult, error) {
+	defer lockIface(cfg, iface)()
+	res := &UpResult{}
+	err := inNamespace(cfg, func() error {
+		return upContext(ctx, cfg, iface, res, logger)
+	})
+	return res, err
+}
+
+func upContext(ctx context.Context, cfg *Config, iface string, res *UpResult, logger *zap.Logger) (err error) {
+	log := ifaceLogger(logger, iface)
+	if err := cfg.Validate(); err != nil {
+		return err
 	}
-	if _, ok := err.(netlink.LinkNotFoundError); !ok {
+	exists, err := InterfaceExists(iface)
+	if err != nil {
 		return err
 	}
-
-	for _, dns := range cfg.DNS {
-		if err := execSh("resolvconf -a tun.%i -m 0 -x", iface, log, fmt.Sprintf("nameserver %s\n", dns)); err != nil {
+	if exists {
+		// reconcile loops call Up over and over, a device already matching the config is fine.
+		// The key must be loaded first, or a config with PrivateKeyFile never matches
+		if err := cfg.loadPrivateKeyFile(); err != nil {
+			log.Error("cannot load private key", zap.Error(err))
 			return err
 		}
+		diff, err := diffInNamespace(cfg, iface)
+		if err != nil {
+			// e.g. the link isn't wireguard, or the device can't be read
+			log.Error("interface exists, but cannot compare it with the config", zap.Error(err))
+			return stepError(os.ErrExist, err)
+		}
+		if diff.Empty() {
+			log.Debug("interface already up to date")
+			return readDevice(cfg, iface, res, log)
+		}
+		return os.ErrExist
+	}
+	res.Created = true
+	// the config might have been parsed long ago, server addresses could have changed since
+	if err := cfg.ResolveEndpoints(); err != nil {
+		log.Error("cannot resolve peer endpoints", zap.Error(err))
+		return err
 	}
 
+	defer func() {
+		if err != nil {
+			rollbackUp(cfg, iface, log)
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if cfg.PreUp != "" {
-		if err := execSh(cfg.PreUp, iface, log); err != nil {
-			return err
+		if err := execSh(ctx, cfg, cfg.PreUp, iface, log); err != nil {
+			return stepError(ErrHook, err)
 		}
+		res.Hooks = append(res.Hooks, "PreUp")
 		log.Info("applied pre-up command")
 	}
-	if err := Sync(cfg, iface, logger); err != nil {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := syncInterface(cfg, iface, SyncWireguardDevice, logger); err != nil {
 		return err
 	}
+	// the link is new, everything the config wants was added
+	added := diffDevice(cfg, &wgtypes.Device{}, nil, nil)
+	res.Addresses = added.AddAddresses
+	res.Routes = added.AddRoutes
+	if err := readDevice(cfg, iface, res, log); err != nil {
+		return err
+	}
+
+	// after the link is set up, like wg-quick, resolvectl needs the link to exist
+	if hasDNS(cfg) {
+		if err := setDNS(ctx, cfg, iface, log); err != nil {
+			return stepError(ErrDNS, err)
+		}
+	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if cfg.PostUp != "" {
-		if err := execSh(cfg.PostUp, iface, log); err != nil {
-			return err
+		if err := execSh(ctx, cfg, cfg.PostUp, iface, log); err != nil {
+			return stepError(ErrHook, err)
 		}
+		res.Hooks = append(res.Hooks, "PostUp")
 		log.Info("applied post-up command")
 	}
 	return nil
 }
 
-// Down destroys the wg interface. Mostly equivalent to `wg-quick down iface`
-func Down(cfg *Config, iface string, logger *zap.Logger) error {
-	log := logger.With(zap.String("iface", iface))
+// readDevice records the settings the kernel may have picked, the listen port and firewall mark, and the configured link
+func readDevice(cfg *Config, iface string, res *UpResult, log *zap.Logger) error {
+	if cfg.dryRun() {
+		// nothing was created, there's no device to read back
+		if cfg.ListenPort != nil {
+			res.ListenPort = *cfg.ListenPort
+		}
+		if cfg.FirewallMark != nil {
+			res.FirewallMark = *cfg.FirewallMark
+		}
+		return nil
+	}
+	dev, err := DeviceStatus(iface)
+	if err != nil {
+		log.Error("cannot read wireguard device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	res.ListenPort = dev.ListenPort
+	res.FirewallMark = dev.FirewallMark
 	link, err := netlink.LinkByName(iface)
 	if err != nil {
+		log.Error("cannot read link", zap.Error(err))
+		return stepError(ErrLinkSync, err)
+	}
+	res.Link = link
+	log.Info("listening", zap.Int("port", dev.ListenPort), zap.Int("fwmark", dev.FirewallMark))
+	return nil
+}
+
+// InterfaceExists reports whether a link named iface exists in the current network namespace, whatever its type
+func InterfaceExists(iface string) (bool, error) {
+	_, err := netlink.LinkByName(iface)
+	if err == nil {
+		return true, nil
+	}
+	if _, ok := err.(netlink.LinkNotFoundError); ok {
+		return false, nil
+	}
+	return false, err
+}
+
+// IsWireGuard reports whether iface is a wireguard link, either a kernel one or a userspace implementation's tun device.
+// It's false without an error if the link doesn't exist
+func IsWireGuard(iface string) (bool, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return link.Type() == "wireguard" || isUserspaceLink(link), nil
+}
+
+// rollbackUp undoes whatever a failed Up managed to set up, the link didn't exist before Up so it's deleted together with its addresses and routes.
+// Errors are only logged, the original error is more relevant to the caller
+func rollbackUp(cfg *Config, iface string, log *zap.Logger) {
+	log.Info("rolling back failed up")
+	if link, err := netlink.LinkByName(iface); err == nil {
+		if err := deleteDefaultRouteRules(cfg, iface, log); err != nil {
+			log.Error("cannot roll back default route rules", zap.Error(err))
+		}
+		if err := deleteExtraRoutes(cfg, link, log); err != nil {
+			log.Error("cannot roll back routes", zap.Error(err))
+		}
+		if err := deleteRules(cfg, log); err != nil {
+			log.Error("cannot roll back rules", zap.Error(err))
+		}
+		if err := netlink.LinkDel(link); err != nil {
+			log.Error("cannot roll back link", zap.Error(err))
+		} else {
+			log.Info("link deleted")
+		}
+	}
+	if hasDNS(cfg) {
+		if err := unsetDNS(context.Background(), cfg, iface, log); err != nil {
+			log.Error("cannot roll back DNS", zap.Error(err))
+		}
+	}
+}
+
+// deleteDefaultRouteRules deletes policy rules added for default routes when Table is auto
+func deleteDefaultRouteRules(cfg *Config, iface string, log *zap.Logger) error {
+	if cfg.Table != TableAuto {
+		return nil
+	}
+	if defaultRoutes, _ := splitDefaultRoutes(allowedIPs(cfg)); len(defaultRoutes) == 0 {
+		return nil
+	}
+	table, err := autoTable(cfg, iface)
+	if err != nil {
+		log.Error("cannot determine table for default routes", zap.Error(err))
 		return err
 	}
+	return deleteAutoTableRules(cfg, table, log)
+}
 
-	if len(cfg.DNS) > 1 {
-		if err := execSh("resolvconf -d tun.%s", iface, log); err != nil {
-			return err
+// Down destroys the wg interface. Mostly equivalent to `wg-quick down iface`
+// Addresses and routes bound to the link are removed together with it, blackhole Routes and Rules are deleted explicitly. If the link doesn't exist Down is a no-op.
+// The steps run in this order, so PreDown sees the interface fully configured and PostDown sees it gone:
+// PreDown, SaveConfig, DNS, policy rules and extra routes, link, PostDown
+func Down(cfg *Config, iface string, logger *zap.Logger) error {
+	return DownContext(context.Background(), cfg, iface, logger)
+}
+
+// DownContext is Down with a context. Cancelling the context kills running hooks and aborts before the next step
+func DownContext(ctx context.Context, cfg *Config, iface string, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	return inNamespace(cfg, func() error {
+		return downContext(ctx, cfg, iface, logger)
+	})
+}
+
+func downContext(ctx context.Context, cfg *Config, iface string, logger *zap.Logger) error {
+	log := ifaceLogger(logger, iface)
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			log.Info("link not found, nothing to do")
+			return nil
 		}
+		return err
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if cfg.PreDown != "" {
-		if err := execSh(cfg.PreDown, iface, log); err != nil {
-			return err
+		if err := execSh(ctx, cfg, cfg.PreDown, iface, log); err != nil {
+			return stepError(ErrHook, err)
 		}
 		log.Info("applied pre-down command")
 	}
 
-	if err := netlink.LinkDel(link); err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+	if cfg.SaveConfig {
+		if err := save(cfg, iface, logger); err != nil {
+			return stepError(ErrSaveConfig, err)
+		}
+	}
+
+	// while the link still exists, resolved's per-link DNS is reverted on it
+	if hasDNS(cfg) {
+		if err := unsetDNS(ctx, cfg, iface, log); err != nil {
+			return stepError(ErrDNS, err)
+		}
+	}
+
+	if err := deleteDefaultRouteRules(cfg, iface, log); err != nil {
+		return stepError(ErrRuleSync, err)
+	}
+	if err := deleteRules(cfg, log); err != nil {
+		return stepError(ErrRuleSync, err)
+	}
+	if err := deleteExtraRoutes(cfg, link, log); err != nil {
+		return stepError(ErrRouteSync, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := cfg.apply(log, "link del", iface, func() error {
+		return netlink.LinkDel(link)
+	}); err != nil {
+		return stepError(ErrLinkDelete, err)
+	}
 	log.Info("link deleted")
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if cfg.PostDown != "" {
-		if err := execSh(cfg.PostDown, iface, log); err != nil {
-			return err
+		if err := execSh(ctx, cfg, cfg.PostDown, iface, log); err != nil {
+			return stepError(ErrHook, err)
 		}
 		log.Info("applied post-down command")
 	}
 	return nil
 }
 
-func execSh(command string, iface string, log *zap.Logger, stdin ...string) error {
-	cmd := exec.Command("sh", "-ce", strings.ReplaceAll(command, "%i", iface))
-	if len(stdin) > 0 {
-		log = log.With(zap.String("stdin", strings.Join(stdin, "")))
-		b := &bytes.Buffer{}
-		for _, ln := range stdin {
-			if _, err := fmt.Fprint(b, ln); err != nil {
-				return err
-			}
-		}
-		cmd.Stdin = b
+// Save writes the current state of the interface to cfg.ConfigFile. Mostly equivalent to `wg-quick save iface`
+// Keys, listen port, firewall mark, peers, addresses and MTU are read from the interface, the rest (including DNS) is kept from cfg.
+func Save(cfg *Config, iface string, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	return inNamespace(cfg, func() error {
+		return save(cfg, iface, logger)
+	})
+}
+
+func save(cfg *Config, iface string, logger *zap.Logger) error {
+	log := ifaceLogger(logger, iface)
+	if cfg.ConfigFile == "" {
+		return fmt.Errorf("cannot save %s, config file path unknown", iface)
 	}
-	out, err := cmd.CombinedOutput()
+	current, err := deviceConfig(cfg, iface)
 	if err != nil {
-		log.Error("failed to execute",
-			zap.Strings("cmd", cmd.Args),
-			zap.ByteString("output", out),
-			zap.Error(err),
-		)
+		log.Error("cannot read current config", zap.Error(err))
 		return err
 	}
-	log.Info("executed",
-		zap.Strings("cmd", cmd.Args),
-		zap.ByteString("output", out),
-	)
+	if err := cfg.apply(log, "write", cfg.ConfigFile, func() error {
+		return current.WriteConfigFile(cfg.ConfigFile)
+	}); err != nil {
+		log.Error("cannot save config", zap.String("path", cfg.ConfigFile), zap.Error(err))
+		return err
+	}
+	log.Info("saved config", zap.String("path", cfg.ConfigFile))
 	return nil
 }
 
+// FromInterface reads the running interface back as a Config, the inverse of Up: private key, listen port, firewall mark and peers from the wireguard device,
+// addresses and MTU from the link. What the kernel doesn't keep, e.g. DNS, Table, hooks or endpoint hostnames, is left unset. Marshal it to export the interface to a file
+func FromInterface(iface string) (*Config, error) {
+	return deviceConfig(&Config{}, iface)
+}
+
+// deviceConfig reconstructs the config from the live interface: wireguard settings from the device, addresses and MTU from the link.
+// Settings which cannot be read back (DNS, Table, hooks...) are copied from cfg
+func deviceConfig(cfg *Config, iface string) (*Config, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	cl, err := wgctrl.New()
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+	dev, err := cl.Device(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	current := *cfg
+	current.EndpointHosts = nil
+	current.Config = wgtypes.Config{
+		PrivateKey: &dev.PrivateKey,
+	}
+	if dev.ListenPort != 0 {
+		port := dev.ListenPort
+		current.ListenPort = &port
+	}
+	if dev.FirewallMark != 0 {
+		mark := dev.FirewallMark
+		current.FirewallMark = &mark
+	}
+	for _, p := range dev.Peers {
+		peer := wgtypes.PeerConfig{
+			PublicKey:  p.PublicKey,
+			Endpoint:   p.Endpoint,
+			AllowedIPs: p.AllowedIPs,
+		}
+		if p.PresharedKey != (wgtypes.Key{}) {
+			psk := p.PresharedKey
+			peer.PresharedKey = &psk
+		}
+		if p.PersistentKeepaliveInterval != 0 {
+			keepalive := p.PersistentKeepaliveInterval
+			peer.PersistentKeepaliveInterval = &keepalive
+		}
+		current.Peers = append(current.Peers, peer)
+		if host, ok := cfg.EndpointHosts[p.PublicKey]; ok {
+			// keep the hostname instead of the address it resolved to
+			if current.EndpointHosts == nil {
+				current.EndpointHosts = make(map[wgtypes.Key]string)
+			}
+			current.EndpointHosts[p.PublicKey] = host
+		}
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	auto := autoMTU(&current, link, zap.NewNop())
+	if auto == 0 {
+		auto = defaultMTU
+	}
+	setLinkConfig(&current, addrs, link.Attrs().MTU, auto)
+	return &current, nil
+}
+
+// setLinkConfig sets addresses and MTU read from the link. The MTU is only recorded when the config set one or when it differs from auto,
+// the MTU Up would discover, so configs relying on automatic MTU keep doing so.
+// DNS is left as is: resolvconf(8) doesn't reliably tell which nameservers came from the interface, so they're kept from the config instead of read back
+func setLinkConfig(current *Config, addrs []netlink.Addr, mtu, auto int) {
+	current.Address = nil
+	for _, addr := range addrs {
+		if !syncedAddr(current, addr) {
+			continue
+		}
+		current.Address = append(current.Address, *addr.IPNet)
+	}
+	if current.MTU != 0 || mtu != auto {
+		current.MTU = mtu
+	}
+}
+
 // Sync the config to the current setup for given interface
 // It perform 4 operations:
 // * SyncLink --> makes sure link is up and type wireguard
 // * SyncWireguardDevice --> configures allowedIP & other wireguard specific settings
 // * SyncAddress --> synces linux addresses bounded to this interface
 // * SyncRoutes --> synces all allowedIP routes to route to this interface
+// When Table is auto, default routes (0.0.0.0/0, ::/0) go to a separate table selected by the firewall mark, with policy rules the same as wg-quick
+// Sync works on both new and already running interfaces and is idempotent, so it's safe to call periodically to converge the interface to the config.
+// Unlike Up it doesn't run hooks nor configure DNS.
 func Sync(cfg *Config, iface string, logger *zap.Logger) error {
-	log := logger.With(zap.String("iface", iface))
+	defer lockIface(cfg, iface)()
+	return inNamespace(cfg, func() error {
+		return syncInterface(cfg, iface, SyncWireguardDevice, logger)
+	})
+}
+
+// Configure is Sync for a link owned by someone else, e.g. systemd-networkd or a CNI plugin. The link must already exist, Configure never creates it
+// and fails with os.ErrNotExist instead. Addresses, routes and the wireguard device are synced as in Sync.
+func Configure(cfg *Config, iface string, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	return inNamespace(cfg, func() error {
+		exists, err := InterfaceExists(iface)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			ifaceLogger(logger, iface).Error("link not found, not creating it")
+			return stepError(ErrLinkSync, os.ErrNotExist)
+		}
+		return syncInterface(cfg, iface, SyncWireguardDevice, logger)
+	})
+}
+
+// syncInterface converges the interface to cfg, the wireguard device is configured with syncDevice
+func syncInterface(cfg *Config, iface string, syncDevice func(cfg *Config, link netlink.Link, log *zap.Logger) error, logger *zap.Logger) error {
+	log := ifaceLogger(logger, iface)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.loadPrivateKeyFile(); err != nil {
+		log.Error("cannot load private key", zap.Error(err))
+		return err
+	}
 
 	link, err := SyncLink(cfg, iface, log)
 	if err != nil {
 		log.Error("cannot sync wireguard link", zap.Error(err))
-		return err
+		return stepError(ErrLinkSync, err)
 	}
 	log.Info("synced link")
 
-	if err := SyncWireguardDevice(cfg, link, log); err != nil {
-		log.Error("cannot sync wireguard link", zap.Error(err))
-		return err
+	managedRoutes := peerRoutes(cfg)
+	var defaultRoutes []net.IPNet
+	if cfg.Table == TableAuto {
+		defaultRoutes, managedRoutes = splitDefaultRoutes(managedRoutes)
 	}
-	log.Info("synced link")
+	if len(defaultRoutes) > 0 {
+		table, err := autoTable(cfg, iface)
+		if err != nil {
+			log.Error("cannot determine table for default routes", zap.Error(err))
+			return stepError(ErrRouteSync, err)
+		}
+		autoCfg := *cfg // don't modify caller's config
+		autoCfg.FirewallMark = &table
+		cfg = &autoCfg
+		log.Info("using separate table for default routes", zap.Int("table", table))
+	}
+
+	if err := syncDevice(cfg, link, log); err != nil {
+		log.Error("cannot sync wireguard device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	log.Info("synced wireguard device")
 
 	if err := SyncAddress(cfg, link, log); err != nil {
 		log.Error("cannot sync addresses", zap.Error(err))
-		return err
+		return stepError(ErrAddrSync, err)
 	}
 	log.Info("synced addresss")
 
-	var managedRoutes []net.IPNet
-	for _, peer := range cfg.Peers {
-		for _, rt := range peer.AllowedIPs {
-			managedRoutes = append(managedRoutes, rt)
-		}
-	}
 	if err := SyncRoutes(cfg, link, managedRoutes, log); err != nil {
 		log.Error("cannot sync routes", zap.Error(err))
-		return err
+		return stepError(ErrRouteSync, err)
 	}
 	log.Info("synced routed")
+
+	tableRoutes := peerTableRoutes(cfg)
+	tables := make([]int, 0, len(tableRoutes))
+	for table := range tableRoutes {
+		tables = append(tables, table)
+	}
+	sort.Ints(tables)
+	for _, table := range tables {
+		routes := tableRoutes[table]
+		tableCfg := *cfg
+		tableCfg.Table = table
+		if err := SyncRoutes(&tableCfg, link, routes, log); err != nil {
+			log.Error("cannot sync peer table routes", zap.Int("table", table), zap.Error(err))
+			return stepError(ErrRouteSync, err)
+		}
+		log.Info("synced peer table routes", zap.Int("table", table))
+	}
+	if err := deleteStaleTableRoutes(cfg, link, log); err != nil {
+		log.Error("cannot delete routes of stale peer tables", zap.Error(err))
+		return stepError(ErrRouteSync, err)
+	}
+
+	if len(cfg.Routes) > 0 {
+		if err := syncExtraRoutes(cfg, link, log); err != nil {
+			log.Error("cannot sync extra routes", zap.Error(err))
+			return stepError(ErrRouteSync, err)
+		}
+		log.Info("synced extra routes")
+	}
+
+	if len(cfg.Rules) > 0 {
+		if err := syncRules(cfg, log); err != nil {
+			log.Error("cannot sync rules", zap.Error(err))
+			return stepError(ErrRuleSync, err)
+		}
+		log.Info("synced rules")
+	}
+
+	if len(defaultRoutes) > 0 {
+		tableCfg := *cfg
+		tableCfg.Table = *cfg.FirewallMark
+		if err := SyncRoutes(&tableCfg, link, defaultRoutes, log); err != nil {
+			log.Error("cannot sync default routes", zap.Error(err))
+			return stepError(ErrRouteSync, err)
+		}
+		if err := syncAutoTableRules(cfg, tableCfg.Table, defaultRoutes, log); err != nil {
+			log.Error("cannot sync default route rules", zap.Error(err))
+			return stepError(ErrRuleSync, err)
+		}
+		log.Info("synced default routes")
+	}
 	log.Info("Successfully synced device")
 	return nil
 
 }
 
 // SyncWireguardDevice synces wireguard vpn setting on the given link. It does not set routes/addresses beyond wg internal crypto-key routing, only handles wireguard specific settings
+// Peers on the device which aren't in the config are removed. Unlike ReplacePeers, peers which stay keep their sessions
 func SyncWireguardDevice(cfg *Config, link netlink.Link, log *zap.Logger) error {
 	cl, err := wgctrl.New()
 	if err != nil {
 		log.Error("cannot setup wireguard device", zap.Error(err))
 		return err
 	}
-	if err := cl.ConfigureDevice(link.Attrs().Name, cfg.Config); err != nil {
+	defer cl.Close()
+
+	wgCfg := cfg.Config
+	if !wgCfg.ReplacePeers {
+		dev, err := cl.Device(link.Attrs().Name)
+		switch {
+		case err == nil:
+			wgCfg.Peers = append(append([]wgtypes.PeerConfig(nil), wgCfg.Peers...), stalePeers(cfg, dev)...)
+		case cfg.dryRun():
+			// the link may not have been created, there's nothing to remove
+		default:
+			log.Error("cannot read wireguard device", zap.Error(err))
+			return err
+		}
+	}
+	if err := cfg.apply(log, "wg set", link.Attrs().Name, func() error {
+		return cl.ConfigureDevice(link.Attrs().Name, wgCfg)
+	}); err != nil {
 		log.Error("cannot configure device", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
+// stalePeers are removals of the device's peers which aren't in the config
+func stalePeers(cfg *Config, dev *wgtypes.Device) []wgtypes.PeerConfig {
+	var stale []wgtypes.PeerConfig
+	for _, p := range dev.Peers {
+		if findPeer(cfg, p.PublicKey) < 0 {
+			stale = append(stale, wgtypes.PeerConfig{PublicKey: p.PublicKey, Remove: true})
+		}
+	}
+	return stale
+}
+
 // SyncLink synces link state with the config. It does not sync Wireguard settings, just makes sure the device is up and type wireguard
+// The link is created and configured purely over netlink, iproute2 isn't required.
+// If the wireguard kernel module isn't available and cfg.Userspace is set, the userspace implementation creates the device instead
 func SyncLink(cfg *Config, iface string, log *zap.Logger) (netlink.Link, error) {
 	link, err := netlink.LinkByName(iface)
 	if err != nil {
@@ -187,9 +652,23 @@ func SyncLink(cfg *Config, iface string, log *zap.Logger) (netlink.Link, error)
 			},
 			LinkType: "wireguard",
 		}
-		if err := netlink.LinkAdd(wgLink); err != nil {
+		err := cfg.apply(log, "link add", iface, func() error {
+			return netlink.LinkAdd(wgLink)
+		})
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			if cfg.Userspace == "" {
+				log.Error("wireguard kernel module not available", zap.Error(err))
+				return nil, stepError(ErrLinkCreate, stepError(ErrModuleNotLoaded, err))
+			}
+			log.Info("wireguard kernel module not available, falling back to userspace implementation", zap.String("userspace", cfg.Userspace))
+			err = createUserspaceLink(cfg, iface, log)
+		}
+		if err != nil {
 			log.Error("cannot create link", zap.Error(err))
-			return nil, err
+			return nil, stepError(ErrLinkCreate, err)
+		}
+		if cfg.dryRun() {
+			return plannedLink(iface), nil
 		}
 
 		link, err = netlink.LinkByName(iface)
@@ -198,7 +677,26 @@ func SyncLink(cfg *Config, iface string, log *zap.Logger) (netlink.Link, error)
 			return nil, err
 		}
 	}
-	if err := netlink.LinkSetUp(link); err != nil {
+	if link.Type() != "wireguard" && !(cfg.Userspace != "" && isUserspaceLink(link)) {
+		log.Error("link is not a wireguard device", zap.String("type", link.Type()))
+		return nil, fmt.Errorf("%w: %s has type %s", ErrNotWireguard, iface, link.Type())
+	}
+	mtu := cfg.MTU
+	if mtu == 0 {
+		mtu = autoMTU(cfg, link, log)
+	}
+	if mtu > 0 && link.Attrs().MTU != mtu {
+		if err := cfg.apply(log, "link set mtu", fmt.Sprint(mtu), func() error {
+			return netlink.LinkSetMTU(link, mtu)
+		}); err != nil {
+			log.Error("cannot set link MTU", zap.Int("mtu", mtu), zap.Error(err))
+			return nil, err
+		}
+		log.Info("set link MTU", zap.Int("mtu", mtu), zap.Bool("auto", cfg.MTU == 0))
+	}
+	if err := cfg.apply(log, "link set up", iface, func() error {
+		return netlink.LinkSetUp(link)
+	}); err != nil {
 		log.Error("cannot set link up", zap.Error(err))
 		return nil, err
 	}
@@ -206,9 +704,37 @@ func SyncLink(cfg *Config, iface string, log *zap.Logger) (netlink.Link, error)
 	return link, nil
 }
 
-// SyncAddress adds/deletes all lind assigned IPV4 addressed as specified in the config
+// managedAddr reports whether the address on the link is subject to sync. Link local addresses (fe80::/10, 169.254.0.0/16), addresses of non-global scope
+// and addresses the kernel manages itself (no permanent flag, e.g. autoconfigured) are never touched
+func managedAddr(addr netlink.Addr) bool {
+	return !addr.IP.IsLinkLocalUnicast() &&
+		addr.Scope == unix.RT_SCOPE_UNIVERSE &&
+		addr.Flags&unix.IFA_F_PERMANENT != 0
+}
+
+// syncedAddr reports whether the address on the link is synced with the config: managed ones, and those with an AddressSpec in cfg whatever their scope
+func syncedAddr(cfg *Config, addr netlink.Addr) bool {
+	if _, ok := cfg.AddressSpecs[addr.IPNet.String()]; ok && addr.Flags&unix.IFA_F_PERMANENT != 0 {
+		return true
+	}
+	return managedAddr(addr)
+}
+
+// nlAddr is the address as it should be on the link, with scope and label from its AddressSpec
+func nlAddr(cfg *Config, addr net.IPNet) *netlink.Addr {
+	a := &netlink.Addr{IPNet: &addr, Label: cfg.AddressLabel}
+	if spec, ok := cfg.AddressSpecs[addr.String()]; ok {
+		a.Scope = spec.Scope
+		if spec.Label != "" {
+			a.Label = spec.Label
+		}
+	}
+	return a
+}
+
+// SyncAddress adds/deletes all link assigned IPv4 and IPv6 addresses as specified in the config. See managedAddr for addresses which are left alone
 func SyncAddress(cfg *Config, link netlink.Link, log *zap.Logger) error {
-	addrs, err := netlink.AddrList(link, syscall.AF_INET)
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
 	if err != nil {
 		log.Error("cannot read link address", zap.Error(err))
 		return err
@@ -217,42 +743,48 @@ func SyncAddress(cfg *Config, link netlink.Link, log *zap.Logger) error {
 	// nil addr means I've used it
 	presentAddresses := make(map[string]netlink.Addr, 0)
 	for _, addr := range addrs {
-		log.With(
+		log := log.With(
 			zap.String("addr", fmt.Sprint(addr.IPNet)),
 			zap.String("label", addr.Label),
-		).Debug("found existing address", zap.String("address", addr.String()))
+		)
+		if !syncedAddr(cfg, addr) {
+			log.Debug("skipping link local or kernel managed address")
+			continue
+		}
+		log.Debug("found existing address", zap.String("address", addr.String()))
 		presentAddresses[addr.IPNet.String()] = addr
 	}
 
 	for _, addr := range cfg.Address {
 		log := log.With(zap.String("addr", addr.String()))
-		_, present := presentAddresses[addr.String()]
+		existing, present := presentAddresses[addr.String()]
 		presentAddresses[addr.String()] = netlink.Addr{} // mark as present
-		if present {
+		want := nlAddr(cfg, addr)
+		if present && !addrSpecChanged(cfg, existing, want) {
 			log.Info("address present")
 			continue
 		}
-		if err := netlink.AddrAdd(link, &netlink.Addr{
-			IPNet: &addr,
-			Label: cfg.AddressLabel,
+		// replace updates an address already on the link with another label or scope instead of failing with EEXIST
+		if err := cfg.apply(log, "addr replace", addr.String(), func() error {
+			return netlink.AddrReplace(link, want)
 		}); err != nil {
-			if err != syscall.EEXIST {
-				log.Error("cannot add addr", zap.Error(err))
-				return err
-			}
+			log.Error("cannot add/replace addr", zap.Error(err))
+			return err
 		}
-		log.Info("address added")
+		log.Info("address added/replaced")
 	}
 
 	for _, addr := range presentAddresses {
 		if addr.IPNet == nil {
 			continue
 		}
-		log.With(
+		log := log.With(
 			zap.String("addr", fmt.Sprint(addr.IPNet)),
 			zap.String("label", addr.Label),
 		)
-		if err := netlink.AddrDel(link, &addr); err != nil {
+		if err := cfg.apply(log, "addr del", addr.IPNet.String(), func() error {
+			return netlink.AddrDel(link, &addr)
+		}); err != nil {
 			log.Error("cannot delete addr", zap.Error(err))
 			return err
 		}
@@ -261,6 +793,15 @@ func SyncAddress(cfg *Config, link netlink.Link, log *zap.Logger) error {
 	return nil
 }
 
+// addrSpecChanged reports whether an address on the link differs from its AddressSpec. Addresses without a spec are never changed,
+// the kernel labels them with the link name when AddressLabel is empty
+func addrSpecChanged(cfg *Config, existing netlink.Addr, want *netlink.Addr) bool {
+	if _, ok := cfg.AddressSpecs[want.IPNet.String()]; !ok {
+		return false
+	}
+	return existing.Scope != want.Scope || (want.Label != "" && existing.Label != want.Label)
+}
+
 func fillRouteDefaults(rt *netlink.Route) {
 	// fill defaults
 	if rt.Table == 0 {
@@ -268,7 +809,7 @@ func fillRouteDefaults(rt *netlink.Route) {
 	}
 
 	if rt.Protocol == 0 {
-		rt.Protocol = unix.RTPROT_BOOT
+		rt.Protocol = DefaultRouteProtocol
 	}
 
 	if rt.Type == 0 {
@@ -276,28 +817,83 @@ func fillRouteDefaults(rt *netlink.Route) {
 	}
 }
 
-// SyncRoutes adds/deletes all route assigned IPV4 addressed as specified in the config
+// routeProtocol is the protocol our routes are tagged with
+func routeProtocol(cfg *Config) int {
+	if cfg.RouteProtocol == 0 {
+		return DefaultRouteProtocol
+	}
+	return cfg.RouteProtocol
+}
+
+// managedRoute returns the route to dst through link with attributes from the config
+func managedRoute(cfg *Config, link netlink.Link, dst net.IPNet) netlink.Route {
+	rt := netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       &dst,
+		Table:     cfg.Table,
+		Protocol:  cfg.RouteProtocol,
+		Priority:  cfg.RouteMetric}
+	fillRouteDefaults(&rt)
+	return rt
+}
+
+// conflictingRoute returns the route among existing which RouteReplace of rt would take over from another link, or nil
+func conflictingRoute(existing []netlink.Route, rt netlink.Route) *netlink.Route {
+	for i, ert := range existing {
+		if ert.Dst == nil || ert.LinkIndex == rt.LinkIndex {
+			continue
+		}
+		if ert.Dst.String() == rt.Dst.String() && ert.Priority == rt.Priority {
+			return &existing[i]
+		}
+	}
+	return nil
+}
+
+// SyncRoutes adds/deletes all IPv4 and IPv6 routes assigned to the link as specified in the config. Routes aren't touched when Table is TableOff
+// Routes go to cfg.Table (main table for TableAuto) with cfg.RouteMetric, so several interfaces routing the same prefixes can be prioritized
+// Routes on the link with routeProtocol which are no longer in the config are deleted, unless cfg.PreserveRoutes is set. Routes with another protocol are left alone
 func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, logger *zap.Logger) error {
+	if cfg.Table == TableOff {
+		logger.Info("table is off, skipping route sync")
+		return nil
+	}
 	var wantedRoutes = make(map[string][]netlink.Route, len(managedRoutes))
-	presentRoutes, err := netlink.RouteList(link, syscall.AF_INET)
+	table := cfg.Table
+	if table == TableAuto {
+		table = unix.RT_TABLE_MAIN
+	}
+	// RouteList only lists the main table
+	presentRoutes, err := netlink.RouteListFiltered(
+		netlink.FAMILY_ALL,
+		&netlink.Route{LinkIndex: link.Attrs().Index, Table: table},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE,
+	)
 	if err != nil {
 		logger.Error("cannot read existing routes", zap.Error(err))
 		return err
 	}
+	if link.Attrs().Index == 0 {
+		// planned link in a dry run, OIF filter would match routes without a link
+		presentRoutes = nil
+	}
 	for _, rt := range managedRoutes {
 		rt := rt // make copy
 		logger.With(zap.String("dst", rt.String())).Debug("managing route")
 
-		nrt := netlink.Route{
-			LinkIndex: link.Attrs().Index,
-			Dst:       &rt,
-			Table:     cfg.Table,
-			Protocol:  cfg.RouteProtocol,
-			Priority:  cfg.RouteMetric}
-		fillRouteDefaults(&nrt)
+		nrt := managedRoute(cfg, link, rt)
 		wantedRoutes[rt.String()] = append(wantedRoutes[rt.String()], nrt)
 	}
 
+	var tableRoutes []netlink.Route
+	if cfg.RouteConflict != RouteConflictReplace {
+		tableRoutes, err = netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+		if err != nil {
+			logger.Error("cannot read existing routes", zap.Error(err))
+			return err
+		}
+	}
+
 	for _, rtLst := range wantedRoutes {
 		for _, rt := range rtLst {
 			rt := rt // make copy
@@ -308,7 +904,18 @@ func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, logge
 				zap.Int("type", rt.Type),
 				zap.Int("metric", rt.Priority),
 			)
-			if err := netlink.RouteReplace(&rt); err != nil {
+			if conflict := conflictingRoute(tableRoutes, rt); conflict != nil {
+				log := log.With(zap.Int("conflicting_link_index", conflict.LinkIndex))
+				if cfg.RouteConflict == RouteConflictSkip {
+					log.Warn("route owned by another link, skipping")
+					continue
+				}
+				log.Error("route owned by another link")
+				return fmt.Errorf("route %s in table %d is owned by link index %d", rt.Dst, rt.Table, conflict.LinkIndex)
+			}
+			if err := cfg.apply(log, "route replace", rt.String(), func() error {
+				return netlink.RouteReplace(&rt)
+			}); err != nil {
 				log.Error("cannot add/replace route", zap.Error(err))
 				return err
 			}
@@ -316,12 +923,19 @@ func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, logge
 		}
 	}
 
+	extra := extraRoutes(cfg, link)
 	checkWanted := func(rt netlink.Route) bool {
 		for _, candidateRt := range wantedRoutes[rt.Dst.String()] {
 			if rt.Equal(candidateRt) {
 				return true
 			}
 		}
+		// cfg.Routes are synced separately, don't delete them
+		for _, candidateRt := range extra {
+			if rt.Equal(candidateRt) {
+				return true
+			}
+		}
 		return false
 	}
 
@@ -338,7 +952,7 @@ func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, logge
 			continue
 		}
 
-		if !(rt.Protocol == cfg.RouteProtocol) {
+		if rt.Protocol != routeProtocol(cfg) {
 			log.Info("skipping route deletion, not owned by this daemon")
 			continue
 		}
@@ -348,7 +962,14 @@ func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, logge
 			continue
 		}
 
-		if err := netlink.RouteDel(&rt); err != nil {
+		if cfg.PreserveRoutes {
+			log.Info("extra route found, preserving")
+			continue
+		}
+
+		if err := cfg.apply(log, "route del", rt.String(), func() error {
+			return netlink.RouteDel(&rt)
+		}); err != nil {
 			log.Error("cannot delete route", zap.Error(err))
 			return err
 		}
@@ -357,3 +978,58 @@ func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, logge
 
 	return nil
 }
+
+// deleteStaleTableRoutes deletes our routes on the link in tables the config no longer uses, e.g. of a peer whose PeerTables entry was removed.
+// Tables still in use are synced on their own, the table of default routes and tables of Routes are left alone
+func deleteStaleTableRoutes(cfg *Config, link netlink.Link, log *zap.Logger) error {
+	if link.Attrs().Index == 0 {
+		// planned link in a dry run, it has no routes yet
+		return nil
+	}
+	routes, err := netlink.RouteListFiltered(
+		netlink.FAMILY_ALL,
+		&netlink.Route{LinkIndex: link.Attrs().Index, Table: unix.RT_TABLE_UNSPEC, Protocol: routeProtocol(cfg)},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL,
+	)
+	if err != nil {
+		return err
+	}
+	used := map[int]bool{unix.RT_TABLE_MAIN: true, cfg.Table: true}
+	for _, table := range cfg.PeerTables {
+		used[table] = true
+	}
+	for _, r := range cfg.Routes {
+		used[r.Table] = true
+	}
+	if cfg.FirewallMark != nil {
+		used[*cfg.FirewallMark] = true
+	}
+	stale := make(map[int]bool)
+	for _, rt := range routes {
+		if !used[rt.Table] {
+			stale[rt.Table] = true
+		}
+	}
+	tables := make([]int, 0, len(stale))
+	for table := range stale {
+		tables = append(tables, table)
+	}
+	sort.Ints(tables)
+	for _, table := range tables {
+		tableCfg := *cfg
+		tableCfg.Table = table
+		if err := SyncRoutes(&tableCfg, link, nil, log); err != nil {
+			return err
+		}
+		log.Info("cleaned up stale peer table", zap.Int("table", table))
+	}
+	return nil
+}
+
+// plannedLink stands in for the link which would have been created if it weren't a dry run
+func plannedLink(iface string) netlink.Link {
+	return &netlink.GenericLink{
+		LinkAttrs: netlink.LinkAttrs{Name: iface},
+		LinkType:  "wireguard",
+	}
+}
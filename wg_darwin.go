@@ -0,0 +1,298 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+// runDir is where wireguard-go keeps its UAPI sockets, and where the utun device backing an interface name is recorded
+const runDir = "/var/run/wireguard"
+
+// defaultUserspace is used when cfg.Userspace is empty, macOS has no kernel implementation
+const defaultUserspace = "wireguard-go"
+
+func nameFile(iface string) string {
+	return filepath.Join(runDir, iface+".name")
+}
+
+// utunName returns the utun device wireguard-go created for iface
+func utunName(iface string) (string, error) {
+	b, err := ioutil.ReadFile(nameFile(iface))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Up starts wireguard-go on a new utun device and configures it, mostly equivalent to `wg-quick up iface` on macOS.
+// The device is configured over its UAPI socket, addresses with ifconfig(8) and routes with route(8).
+// Default routes, DNS, Table, FwMark, Namespace and Rules aren't supported on macOS yet
+func Up(cfg *Config, iface string, logger *zap.Logger) error {
+	return UpContext(context.Background(), cfg, iface, logger)
+}
+
+// UpContext is Up with a context. Cancelling the context kills running hooks and aborts before the next step
+func UpContext(ctx context.Context, cfg *Config, iface string, logger *zap.Logger) (err error) {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.loadPrivateKeyFile(); err != nil {
+		log.Error("cannot load private key", zap.Error(err))
+		return err
+	}
+	if defaults, _ := splitDefaultRoutes(allowedIPs(cfg)); len(defaults) > 0 && cfg.Table != TableOff {
+		return fmt.Errorf("%w: default routes", ErrNotSupported)
+	}
+	if len(cfg.DNS) > 0 || len(cfg.SearchDomains) > 0 || cfg.Namespace != "" || cfg.Table > 0 || cfg.FirewallMark != nil || len(cfg.Rules) > 0 || len(cfg.PeerTables) > 0 || len(cfg.AddressSpecs) > 0 {
+		return fmt.Errorf("%w: DNS, SearchDomains, Namespace, Table, FwMark, Rules, PeerTables and AddressSpecs", ErrNotSupported)
+	}
+	if _, err := utunName(iface); err == nil {
+		return os.ErrExist
+	}
+	if err := cfg.ResolveEndpoints(); err != nil {
+		log.Error("cannot resolve peer endpoints", zap.Error(err))
+		return err
+	}
+
+	if cfg.PreUp != "" {
+		if err := execSh(ctx, cfg, cfg.PreUp, iface, log); err != nil {
+			return stepError(ErrHook, err)
+		}
+		log.Info("applied pre-up command")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	utun, err := createUtun(ctx, cfg, iface, log)
+	if err != nil {
+		return stepError(ErrLinkCreate, err)
+	}
+	defer func() {
+		if err != nil {
+			log.Info("rolling back failed up")
+			deleteUtun(cfg, iface, utun, log)
+		}
+	}()
+
+	if err := syncUtun(ctx, cfg, utun, log); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cfg.PostUp != "" {
+		if err := execSh(ctx, cfg, cfg.PostUp, iface, log); err != nil {
+			return stepError(ErrHook, err)
+		}
+		log.Info("applied post-up command")
+	}
+	return nil
+}
+
+// createUtun runs wireguard-go, which picks the next free utun device and writes its name to nameFile
+func createUtun(ctx context.Context, cfg *Config, iface string, log *zap.Logger) (string, error) {
+	userspace := cfg.Userspace
+	if userspace == "" {
+		userspace = defaultUserspace
+	}
+	if err := cfg.apply(log, "exec", userspace+" utun", func() error {
+		if err := os.MkdirAll(runDir, 0755); err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, userspace, "utun")
+		cmd.Env = append(os.Environ(), "WG_TUN_NAME_FILE="+nameFile(iface))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			log.Error("failed to execute", zap.Strings("cmd", cmd.Args), zap.ByteString("output", out), zap.Error(err))
+			return err
+		}
+		log.Info("executed", zap.Strings("cmd", cmd.Args), zap.ByteString("output", out))
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	if cfg.dryRun() {
+		return "utun", nil
+	}
+	utun, err := utunName(iface)
+	if err != nil {
+		log.Error("cannot read utun device name", zap.Error(err))
+		return "", err
+	}
+	log.Info("created utun device", zap.String("utun", utun))
+	return utun, nil
+}
+
+// syncUtun configures the wireguard device, addresses, MTU and routes of the utun device
+func syncUtun(ctx context.Context, cfg *Config, utun string, log *zap.Logger) error {
+	log = log.With(zap.String("utun", utun))
+	cl, err := wgctrl.New()
+	if err != nil {
+		log.Error("cannot setup wireguard device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	defer cl.Close()
+	if err := cfg.apply(log, "wg set", utun, func() error {
+		return cl.ConfigureDevice(utun, cfg.Config)
+	}); err != nil {
+		log.Error("cannot configure device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	log.Info("synced wireguard device")
+
+	for _, addr := range cfg.Address {
+		// like wg-quick's darwin script: IPv4 is point-to-point with the address itself as destination, IPv6 takes no destination
+		args := []string{utun, "inet", addr.String(), addr.IP.String(), "alias"}
+		if addr.IP.To4() == nil {
+			args = []string{utun, "inet6", addr.String(), "alias"}
+		}
+		if err := runCommand(ctx, cfg, log, "ifconfig", args...); err != nil {
+			return stepError(ErrAddrSync, err)
+		}
+	}
+	if cfg.MTU > 0 {
+		if err := runCommand(ctx, cfg, log, "ifconfig", utun, "mtu", fmt.Sprint(cfg.MTU)); err != nil {
+			return stepError(ErrLinkSync, err)
+		}
+	}
+	if err := runCommand(ctx, cfg, log, "ifconfig", utun, "up"); err != nil {
+		return stepError(ErrLinkSync, err)
+	}
+
+	if cfg.Table == TableOff {
+		return nil
+	}
+	routes := peerRoutes(cfg)
+	for _, r := range cfg.Routes {
+		if !r.Blackhole {
+			routes = append(routes, r.Dst)
+		}
+	}
+	for _, rt := range maskedIPNets(routes) {
+		family := "-inet"
+		if rt.IP.To4() == nil {
+			family = "-inet6"
+		}
+		if err := runCommand(ctx, cfg, log, "route", "-q", "-n", "add", family, rt.String(), "-interface", utun); err != nil {
+			return stepError(ErrRouteSync, err)
+		}
+	}
+	log.Info("synced routes")
+	return nil
+}
+
+// Down stops wireguard-go by removing its UAPI socket, the utun device and its routes are removed together with it
+func Down(cfg *Config, iface string, logger *zap.Logger) error {
+	return DownContext(context.Background(), cfg, iface, logger)
+}
+
+// DownContext is Down with a context. Cancelling the context kills running hooks and aborts before the next step
+func DownContext(ctx context.Context, cfg *Config, iface string, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface)
+	utun, err := utunName(iface)
+	if os.IsNotExist(err) {
+		log.Info("interface not found, nothing to do")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if cfg.PreDown != "" {
+		if err := execSh(ctx, cfg, cfg.PreDown, iface, log); err != nil {
+			return stepError(ErrHook, err)
+		}
+		log.Info("applied pre-down command")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := deleteUtun(cfg, iface, utun, log); err != nil {
+		return stepError(ErrLinkDelete, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cfg.PostDown != "" {
+		if err := execSh(ctx, cfg, cfg.PostDown, iface, log); err != nil {
+			return stepError(ErrHook, err)
+		}
+		log.Info("applied post-down command")
+	}
+	return nil
+}
+
+func deleteUtun(cfg *Config, iface string, utun string, log *zap.Logger) error {
+	for _, path := range []string{filepath.Join(runDir, utun+".sock"), nameFile(iface)} {
+		path := path
+		if err := cfg.apply(log, "remove", path, func() error {
+			return os.Remove(path)
+		}); err != nil && !os.IsNotExist(err) {
+			log.Error("cannot remove", zap.String("path", path), zap.Error(err))
+			return err
+		}
+	}
+	log.Info("utun device deleted", zap.String("utun", utun))
+	return nil
+}
+
+// Sync updates keys, listen port and peers of a running interface over its UAPI socket.
+// Addresses and routes are only set on Up
+func Sync(cfg *Config, iface string, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.loadPrivateKeyFile(); err != nil {
+		log.Error("cannot load private key", zap.Error(err))
+		return err
+	}
+	utun, err := utunName(iface)
+	if err != nil {
+		log.Error("cannot read utun device name", zap.Error(err))
+		return stepError(ErrLinkSync, err)
+	}
+	cl, err := wgctrl.New()
+	if err != nil {
+		log.Error("cannot setup wireguard device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	defer cl.Close()
+	if err := cfg.apply(log, "wg set", utun, func() error {
+		return cl.ConfigureDevice(utun, cfg.Config)
+	}); err != nil {
+		log.Error("cannot configure device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	log.Info("synced wireguard device")
+	return nil
+}
+
+func runCommand(ctx context.Context, cfg *Config, log *zap.Logger, name string, args ...string) error {
+	return cfg.apply(log, "exec", name+" "+strings.Join(args, " "), func() error {
+		cmd := exec.CommandContext(ctx, name, args...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			log.Error("failed to execute", zap.Strings("cmd", cmd.Args), zap.ByteString("output", out), zap.Error(err))
+			return err
+		}
+		log.Info("executed", zap.Strings("cmd", cmd.Args), zap.ByteString("output", out))
+		return nil
+	})
+}
@@ -0,0 +1,151 @@
+//go:build linux
+// +build linux
+
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestConflictingRoute(t *testing.T) {
+	_, dst, _ := net.ParseCIDR("10.0.0.0/24")
+	_, other, _ := net.ParseCIDR("10.0.1.0/24")
+	existing := []netlink.Route{
+		{LinkIndex: 2, Dst: other},
+		{LinkIndex: 3, Dst: dst, Priority: 100},
+		{LinkIndex: 7, Dst: dst},
+	}
+
+	assert.Nil(t, conflictingRoute(existing, netlink.Route{LinkIndex: 7, Dst: dst}))
+	assert.Nil(t, conflictingRoute(existing, netlink.Route{LinkIndex: 5, Dst: dst, Priority: 10}))
+	if conflict := conflictingRoute(existing, netlink.Route{LinkIndex: 5, Dst: dst, Priority: 100}); assert.NotNil(t, conflict) {
+		assert.Equal(t, 3, conflict.LinkIndex)
+	}
+}
+
+func TestSetLinkConfig(t *testing.T) {
+	ip, addr, _ := net.ParseCIDR("10.0.0.2/24")
+	addr.IP = ip
+	ll, llAddr, _ := net.ParseCIDR("fe80::1/64")
+	llAddr.IP = ll
+	addrs := []netlink.Addr{{IPNet: addr, Flags: unix.IFA_F_PERMANENT}, {IPNet: llAddr, Flags: unix.IFA_F_PERMANENT}}
+
+	current := &Config{DNS: []net.IP{net.ParseIP("10.0.0.1")}}
+	setLinkConfig(current, addrs, defaultMTU, defaultMTU)
+	assert.Equal(t, []net.IPNet{*addr}, current.Address)
+	assert.Equal(t, 0, current.MTU)
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.1")}, current.DNS)
+
+	// discovered MTU, not recorded
+	setLinkConfig(current, addrs, 1380, 1380)
+	assert.Equal(t, 0, current.MTU)
+
+	// set by hand on the link
+	setLinkConfig(current, addrs, 1280, 1380)
+	assert.Equal(t, 1280, current.MTU)
+
+	current = &Config{MTU: 1380}
+	setLinkConfig(current, addrs, defaultMTU, defaultMTU)
+	assert.Equal(t, defaultMTU, current.MTU)
+}
+
+func TestManagedRouteProtocol(t *testing.T) {
+	link := &netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Index: 3}}
+	_, dst, _ := net.ParseCIDR("10.0.0.0/24")
+
+	rt := managedRoute(&Config{}, link, *dst)
+	assert.Equal(t, DefaultRouteProtocol, rt.Protocol)
+	assert.Equal(t, DefaultRouteProtocol, routeProtocol(&Config{}))
+
+	rt = managedRoute(&Config{RouteProtocol: 42}, link, *dst)
+	assert.Equal(t, 42, rt.Protocol)
+	assert.Equal(t, 42, routeProtocol(&Config{RouteProtocol: 42}))
+}
+
+func TestManagedAddr(t *testing.T) {
+	parse := func(cidr string) *net.IPNet {
+		ip, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.IP = ip
+		return n
+	}
+	assert.True(t, managedAddr(netlink.Addr{IPNet: parse("10.0.0.2/24"), Flags: unix.IFA_F_PERMANENT}))
+	assert.True(t, managedAddr(netlink.Addr{IPNet: parse("fd00::2/64"), Flags: unix.IFA_F_PERMANENT}))
+	// auto assigned IPv6 link local address survives sync
+	assert.False(t, managedAddr(netlink.Addr{IPNet: parse("fe80::1234/64"), Flags: unix.IFA_F_PERMANENT, Scope: unix.RT_SCOPE_LINK}))
+	assert.False(t, managedAddr(netlink.Addr{IPNet: parse("169.254.1.1/16"), Flags: unix.IFA_F_PERMANENT}))
+	assert.False(t, managedAddr(netlink.Addr{IPNet: parse("10.0.0.3/32"), Flags: unix.IFA_F_PERMANENT, Scope: unix.RT_SCOPE_HOST}))
+	// autoconfigured, kernel removes it on its own
+	assert.False(t, managedAddr(netlink.Addr{IPNet: parse("2001:db8::1/64")}))
+}
+
+func TestAddressSpecs(t *testing.T) {
+	_, n, _ := net.ParseCIDR("10.0.0.3/32")
+	cfg := &Config{
+		Address:      []net.IPNet{*n},
+		AddressLabel: "wg0",
+		AddressSpecs: map[string]AddressSpec{"10.0.0.3/32": {Scope: unix.RT_SCOPE_HOST, Label: "wg0:host"}},
+	}
+	existing := netlink.Addr{IPNet: n, Flags: unix.IFA_F_PERMANENT, Scope: unix.RT_SCOPE_HOST, Label: "wg0:host"}
+	// non-global scope, but it's in the config
+	assert.True(t, syncedAddr(cfg, existing))
+	assert.False(t, syncedAddr(&Config{}, existing))
+
+	want := nlAddr(cfg, *n)
+	assert.Equal(t, unix.RT_SCOPE_HOST, want.Scope)
+	assert.Equal(t, "wg0:host", want.Label)
+	assert.False(t, addrSpecChanged(cfg, existing, want))
+	existing.Scope = unix.RT_SCOPE_UNIVERSE
+	assert.True(t, addrSpecChanged(cfg, existing, want))
+
+	want = nlAddr(&Config{AddressLabel: "wg0"}, *n)
+	assert.Equal(t, unix.RT_SCOPE_UNIVERSE, want.Scope)
+	assert.Equal(t, "wg0", want.Label)
+}
+
+func TestInterfaceExists(t *testing.T) {
+	exists, err := InterfaceExists("lo")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	isWG, err := IsWireGuard("lo")
+	assert.NoError(t, err)
+	assert.False(t, isWG)
+
+	exists, err = InterfaceExists("wgquicktest0")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	isWG, err = IsWireGuard("wgquicktest0")
+	assert.NoError(t, err)
+	assert.False(t, isWG)
+}
+
+func TestStalePeers(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(testConfigs["sample-2"])))
+	removed, err := GeneratePrivateKey()
+	assert.NoError(t, err)
+	dev := &wgtypes.Device{Peers: []wgtypes.Peer{{PublicKey: cfg.Peers[0].PublicKey}, {PublicKey: removed}}}
+	assert.Equal(t, []wgtypes.PeerConfig{{PublicKey: removed, Remove: true}}, stalePeers(cfg, dev))
+}
+
+func TestPlanUpKeepsConfig(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.UnmarshalText([]byte(testConfigs["simple"])))
+	key := cfg.Peers[0].PublicKey
+	cfg.EndpointHosts = map[wgtypes.Key]string{key: "localhost:51820"}
+	endpoint := cfg.Peers[0].Endpoint
+
+	_, err := PlanUp(cfg, "wgqtplan0", zap.NewNop())
+	assert.NoError(t, err)
+	assert.True(t, endpoint == cfg.Peers[0].Endpoint, "endpoint replaced in the caller's config")
+	assert.Equal(t, "123.12.12.1:51820", cfg.Peers[0].Endpoint.String())
+}
@@ -0,0 +1,230 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+// wireguardExe is the wireguard-windows client. Its tunnel service creates the Wintun adapter and sets addresses, routes and DNS from the config
+var wireguardExe = "wireguard.exe"
+
+// tunnelConfigPath is where the config of the tunnel service is kept. The service reads it on every start, so it stays until Down
+func tunnelConfigPath(iface string) string {
+	return filepath.Join(os.Getenv("ProgramData"), "wg-quick-go", iface+".conf")
+}
+
+// Up installs and starts the wireguard-windows tunnel service for the interface, equivalent to `wireguard /installtunnelservice`.
+// The config is validated first, see Config.Validate. Hooks run from cmd.exe, Table, FwMark, Namespace, Routes and Rules aren't supported on Windows
+func Up(cfg *Config, iface string, logger *zap.Logger) error {
+	return UpContext(context.Background(), cfg, iface, logger)
+}
+
+// UpContext is Up with a context. Cancelling the context kills running hooks and aborts before the next step.
+// If a step after writing the tunnel config fails, the service is uninstalled and the config, which holds the private key, is removed again
+func UpContext(ctx context.Context, cfg *Config, iface string, logger *zap.Logger) (err error) {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.loadPrivateKeyFile(); err != nil {
+		log.Error("cannot load private key", zap.Error(err))
+		return err
+	}
+	if cfg.Namespace != "" || cfg.Table != TableAuto || cfg.FirewallMark != nil || len(cfg.Routes) > 0 || len(cfg.Rules) > 0 || len(cfg.PeerTables) > 0 || len(cfg.AddressSpecs) > 0 {
+		return fmt.Errorf("%w: Namespace, Table, FwMark, Routes, Rules, PeerTables and AddressSpecs", ErrNotSupported)
+	}
+	if err := cfg.ResolveEndpoints(); err != nil {
+		log.Error("cannot resolve peer endpoints", zap.Error(err))
+		return err
+	}
+
+	if cfg.PreUp != "" {
+		if err := execSh(ctx, cfg, cfg.PreUp, iface, log); err != nil {
+			return stepError(ErrHook, err)
+		}
+		log.Info("applied pre-up command")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// hooks are run here, the service must not run them again
+	serviceCfg := *cfg
+	serviceCfg.PreUp, serviceCfg.PostUp, serviceCfg.PreDown, serviceCfg.PostDown = "", "", "", ""
+	serviceCfg.SaveConfig = false
+	// the service doesn't know PrivateKeyFile, the key was loaded above
+	serviceCfg.PrivateKeyFile = ""
+	path := tunnelConfigPath(iface)
+	if err := cfg.apply(log, "write", path, func() error {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		return serviceCfg.WriteConfigFile(path)
+	}); err != nil {
+		log.Error("cannot write tunnel config", zap.String("path", path), zap.Error(err))
+		return stepError(ErrLinkCreate, err)
+	}
+	installed := false
+	defer func() {
+		if err != nil {
+			rollbackUp(cfg, iface, installed, log)
+		}
+	}()
+	if err := runWireguard(ctx, cfg, log, "/installtunnelservice", path); err != nil {
+		return stepError(ErrLinkCreate, err)
+	}
+	installed = true
+	log.Info("installed tunnel service")
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cfg.PostUp != "" {
+		if err := execSh(ctx, cfg, cfg.PostUp, iface, log); err != nil {
+			return stepError(ErrHook, err)
+		}
+		log.Info("applied post-up command")
+	}
+	return nil
+}
+
+// rollbackUp undoes a failed Up: it uninstalls the tunnel service if it was installed, and removes the tunnel config.
+// Errors are only logged, the original error is more relevant to the caller
+func rollbackUp(cfg *Config, iface string, installed bool, log *zap.Logger) {
+	log.Info("rolling back failed up")
+	if installed {
+		// the context of Up may be what failed it
+		if err := runWireguard(context.Background(), cfg, log, "/uninstalltunnelservice", iface); err != nil {
+			log.Error("cannot roll back tunnel service", zap.Error(err))
+		}
+	}
+	path := tunnelConfigPath(iface)
+	if err := cfg.apply(log, "remove", path, func() error {
+		return os.Remove(path)
+	}); err != nil && !os.IsNotExist(err) {
+		log.Error("cannot remove tunnel config", zap.String("path", path), zap.Error(err))
+	}
+}
+
+// Down stops and removes the tunnel service, equivalent to `wireguard /uninstalltunnelservice`. The adapter is removed together with it
+func Down(cfg *Config, iface string, logger *zap.Logger) error {
+	return DownContext(context.Background(), cfg, iface, logger)
+}
+
+// DownContext is Down with a context. Cancelling the context kills running hooks and aborts before the next step
+func DownContext(ctx context.Context, cfg *Config, iface string, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface)
+	if cfg.PreDown != "" {
+		if err := execSh(ctx, cfg, cfg.PreDown, iface, log); err != nil {
+			return stepError(ErrHook, err)
+		}
+		log.Info("applied pre-down command")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := runWireguard(ctx, cfg, log, "/uninstalltunnelservice", iface); err != nil {
+		return stepError(ErrLinkDelete, err)
+	}
+	path := tunnelConfigPath(iface)
+	if err := cfg.apply(log, "remove", path, func() error {
+		return os.Remove(path)
+	}); err != nil && !os.IsNotExist(err) {
+		log.Error("cannot remove tunnel config", zap.String("path", path), zap.Error(err))
+	}
+	log.Info("uninstalled tunnel service")
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cfg.PostDown != "" {
+		if err := execSh(ctx, cfg, cfg.PostDown, iface, log); err != nil {
+			return stepError(ErrHook, err)
+		}
+		log.Info("applied post-down command")
+	}
+	return nil
+}
+
+// Sync updates keys, listen port and peers of a running tunnel over its UAPI named pipe.
+// Addresses, routes and DNS are only set by the tunnel service on Up
+func Sync(cfg *Config, iface string, logger *zap.Logger) error {
+	defer lockIface(cfg, iface)()
+	log := ifaceLogger(logger, iface)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.loadPrivateKeyFile(); err != nil {
+		log.Error("cannot load private key", zap.Error(err))
+		return err
+	}
+	cl, err := wgctrl.New()
+	if err != nil {
+		log.Error("cannot setup wireguard device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	defer cl.Close()
+	if err := cfg.apply(log, "wg set", iface, func() error {
+		return cl.ConfigureDevice(iface, cfg.Config)
+	}); err != nil {
+		log.Error("cannot configure device", zap.Error(err))
+		return stepError(ErrDeviceSync, err)
+	}
+	log.Info("synced wireguard device")
+	return nil
+}
+
+func runWireguard(ctx context.Context, cfg *Config, log *zap.Logger, args ...string) error {
+	return cfg.apply(log, "exec", wireguardExe+" "+strings.Join(args, " "), func() error {
+		out, err := exec.CommandContext(ctx, wireguardExe, args...).CombinedOutput()
+		if err != nil {
+			log.Error("failed to execute",
+				zap.String("cmd", wireguardExe),
+				zap.Strings("args", args),
+				zap.ByteString("output", out),
+				zap.Error(err),
+			)
+			return err
+		}
+		log.Info("executed", zap.String("cmd", wireguardExe), zap.Strings("args", args))
+		return nil
+	})
+}
+
+// execSh runs the hook with cfg's CommandRunner, %i is expanded to the interface name
+func execSh(ctx context.Context, cfg *Config, command string, iface string, log *zap.Logger) error {
+	for _, line := range hookLines(command) {
+		line = strings.ReplaceAll(line, "%i", iface)
+		if err := cfg.apply(log, "exec", line, func() error {
+			out, err := cfg.runner().Run(ctx, line, "")
+			if err != nil {
+				log.Error("failed to execute", zap.String("cmd", line), zap.ByteString("output", out), zap.Error(err))
+				return err
+			}
+			log.Info("executed", zap.String("cmd", line), zap.ByteString("output", out))
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run runs command with `cmd.exe /C`
+func (ShellRunner) Run(ctx context.Context, command string, stdin string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "cmd.exe", "/C", command)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	return cmd.CombinedOutput()
+}
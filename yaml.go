@@ -0,0 +1,22 @@
+package wgquick
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+var _ yaml.Marshaler = (*Config)(nil)
+var _ yaml.Unmarshaler = (*Config)(nil)
+
+// MarshalYAML encodes the config as YAML, using the same conventions as MarshalJSON
+func (cfg *Config) MarshalYAML() (interface{}, error) {
+	return cfg.encode(), nil
+}
+
+// UnmarshalYAML decodes the config from YAML produced by MarshalYAML
+func (cfg *Config) UnmarshalYAML(value *yaml.Node) error {
+	var ec encodedConfig
+	if err := value.Decode(&ec); err != nil {
+		return err
+	}
+	return cfg.decode(&ec)
+}
@@ -0,0 +1,46 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLRoundTrip(t *testing.T) {
+	for name, cfg := range testConfigs {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			assert.NoError(t, c.UnmarshalText([]byte(cfg)))
+			b, err := yaml.Marshal(c)
+			assert.NoError(t, err)
+			t.Logf("Got YAML:\n%s", b)
+
+			c2 := &Config{}
+			assert.NoError(t, yaml.Unmarshal(b, c2))
+			assert.Equal(t, cfg, c2.String())
+		})
+	}
+}
+
+func TestYAMLDecoding(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+PrivateKey: yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address:
+  - 10.192.122.1/24
+Peers:
+  - PublicKey: xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+    AllowedIPs: [0.0.0.0/0]
+    PersistentKeepalive: 25
+`), c))
+	assert.Equal(t, `[Interface]
+Address = 10.192.122.1/24
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0
+PersistentKeepalive = 25
+`, c.String())
+}